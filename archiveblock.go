@@ -1,7 +1,13 @@
 package unity
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
 
 	lz4 "github.com/cloudflare/golz4"
 )
@@ -20,88 +26,395 @@ type ArchiveBlockInfo struct {
 }
 
 func (block *ArchiveBlockInfo) Decompress(data []byte) ([]byte, error) {
+	return block.decompress(data, DefaultLimits.withDefaults())
+}
+
+// Decompresses the block within limits, which must have their defaults set.
+func (block *ArchiveBlockInfo) decompress(data []byte, limits Limits) ([]byte, error) {
 	comp := int(block.Flags & 0x3F)
+	if block.UncompressedSize < 0 {
+		return nil, fmt.Errorf("unity.ArchiveBlockInfo.Decompress: Invalid uncompressed size: %v", block.UncompressedSize)
+	}
 	switch comp {
 	case CompressionNone:
 		return data, nil
 	case CompressionLZMA:
-		return DecompressLZMARaw(data, block.UncompressedSize)
-	case CompressionLZ4:
-	case CompressionLZ4HC:
+		return decompressLZMARaw(data, block.UncompressedSize, limits)
+	case CompressionLZ4, CompressionLZ4HC:
+		// The decoder dereferences the buffers even when they are empty
+		if len(data) == 0 || block.UncompressedSize == 0 {
+			if len(data) == 0 && block.UncompressedSize == 0 {
+				return []byte{}, nil
+			}
+			return nil, errors.New("unity.ArchiveBlockInfo.Decompress: Invalid LZ4 block size")
+		}
 		decompressed := make([]byte, int(block.UncompressedSize))
 		return decompressed, lz4.Uncompress(data, decompressed)
 	}
 	return nil, fmt.Errorf("unity.ArchiveBlockInfo.Decompress: Unsupported compression type: %v", comp)
 }
 
+// ArchiveBlockStorage presents the data blocks of an archive storage bundle
+// as one seekable stream of their concatenated uncompressed contents. Node
+// offsets in the directory refer to this virtual stream.
 type ArchiveBlockStorage struct {
-	*Reader
+	Source             io.ReaderAt
 	Blocks             []ArchiveBlockInfo
 	VirtualSize        int64
 	Cursor             int64
 	BaseOffset         int64
 	CurrentBlockIndex  int
 	CurrentBlockOffset int64
-	CurrentBlock       *Reader
+	CurrentBlock       []byte
+	Cache              *BlockCache // Optional cache of decompressed blocks
+	Workers            int         // Decompressing goroutines, runtime.NumCPU() if 0
+	Limits             Limits      // Decompression limits, DefaultLimits if zero
+
+	// Uncompressed and compressed start of every block
+	offsets           []int64
+	compressedOffsets []int64
+
+	// Guards the current block, data and loads. Blocks are decompressed
+	// without holding it.
+	mu sync.Mutex
+
+	// All blocks, once decompressed by DecompressAll
+	data []byte
+
+	// Blocks being decompressed, which other readers wait for
+	loads map[int]*blockLoad
+}
+
+// A block decompression that finished when done is closed
+type blockLoad struct {
+	done chan struct{}
+	data []byte
+	err  error
 }
 
-func NewArchiveBlockStorage(reader *Reader, blocks []ArchiveBlockInfo) *ArchiveBlockStorage {
+// Creates a storage for blocks that are stored back to back in source,
+// starting at baseOffset.
+func NewArchiveBlockStorage(source io.ReaderAt, baseOffset int64, blocks []ArchiveBlockInfo) *ArchiveBlockStorage {
 	storage := ArchiveBlockStorage{
-		Reader:            reader,
+		Source:            source,
 		Blocks:            blocks,
-		BaseOffset:        reader.Tell(),
+		BaseOffset:        baseOffset,
 		CurrentBlockIndex: -1,
+		offsets:           make([]int64, len(blocks)),
+		compressedOffsets: make([]int64, len(blocks)),
 	}
 
-	for _, block := range blocks {
+	compressedOffset := int64(0)
+	for i, block := range blocks {
+		storage.offsets[i] = storage.VirtualSize
+		storage.compressedOffsets[i] = compressedOffset
 		storage.VirtualSize += int64(block.UncompressedSize)
+		compressedOffset += int64(block.CompressedSize)
 	}
 
 	return &storage
 }
 
+func (storage *ArchiveBlockStorage) Size() int64 {
+	return storage.VirtualSize
+}
+
+func (storage *ArchiveBlockStorage) Read(p []byte) (int, error) {
+	n, err := storage.ReadAt(p, storage.Cursor)
+	storage.Cursor += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (storage *ArchiveBlockStorage) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += storage.Cursor
+	case io.SeekEnd:
+		offset += storage.VirtualSize
+	default:
+		return 0, errors.New("unity.ArchiveBlockStorage.Seek: invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, fmt.Errorf("unity.ArchiveBlockStorage.Seek: invalid offset (%v)", offset)
+	}
+
+	storage.Cursor = offset
+	return offset, nil
+}
+
+// Reads len(p) bytes at the virtual offset off, decompressing every block
+// the range touches, concurrently when there are several. It is safe for
+// concurrent use: readers of different blocks decompress in parallel and
+// readers of the same block wait for one decompression.
+func (storage *ArchiveBlockStorage) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("unity.ArchiveBlockStorage.ReadAt: invalid offset (%v)", off)
+	}
+
+	storage.mu.Lock()
+	data := storage.data
+	storage.mu.Unlock()
+
+	if data != nil {
+		if off >= int64(len(data)) {
+			return 0, io.EOF
+		}
+		if n = copy(p, data[off:]); n < len(p) {
+			return n, io.EOF
+		}
+		return n, nil
+	}
+
+	// Ranges over several blocks are decompressed concurrently
+	if workers := storage.workers(); workers > 1 && off < storage.VirtualSize {
+		end := off + int64(len(p))
+		if end > storage.VirtualSize {
+			end = storage.VirtualSize
+		}
+		if storage.blockIndex(end-1) > storage.blockIndex(off) {
+			n = int(end - off)
+			if err = storage.decompressRange(p[:n], off, workers, true); err != nil {
+				return 0, err
+			}
+			if n < len(p) {
+				return n, io.EOF
+			}
+			return n, nil
+		}
+	}
+
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= storage.VirtualSize {
+			return n, io.EOF
+		}
+
+		block, start, err := storage.blockAt(pos)
+		if err != nil {
+			return n, err
+		}
+
+		n += copy(p[n:], block[pos-start:])
+	}
+
+	return n, nil
+}
+
+// Decompresses every block into memory, using Workers goroutines. Later
+// reads are served from memory.
+func (storage *ArchiveBlockStorage) DecompressAll() error {
+	storage.mu.Lock()
+	done := storage.data != nil
+	storage.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	data := make([]byte, storage.VirtualSize)
+	if err := storage.decompressRange(data, 0, storage.workers(), false); err != nil {
+		return err
+	}
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	storage.data = data
+	storage.CurrentBlockIndex = -1
+	storage.CurrentBlock = nil
+
+	return nil
+}
+
+// Reports whether all blocks are stored uncompressed, back to back.
+func (storage *ArchiveBlockStorage) uncompressed() bool {
+	for _, block := range storage.Blocks {
+		if block.Flags&ArchiveCompressionMask != CompressionNone || block.CompressedSize != block.UncompressedSize {
+			return false
+		}
+	}
+	return true
+}
+
+func (storage *ArchiveBlockStorage) workers() int {
+	if storage.Workers > 0 {
+		return storage.Workers
+	}
+	return runtime.NumCPU()
+}
+
+// Decompresses the blocks overlapping the virtual range at off into p with
+// a pool of workers, each copying its blocks to their offsets in p.
+func (storage *ArchiveBlockStorage) decompressRange(p []byte, off int64, workers int, useCache bool) error {
+	if len(p) == 0 {
+		return nil
+	}
+
+	first := storage.blockIndex(off)
+	last := storage.blockIndex(off + int64(len(p)) - 1)
+	if last >= len(storage.Blocks) {
+		return io.ErrUnexpectedEOF
+	}
+	if workers > last-first+1 {
+		workers = last - first + 1
+	}
+
+	var failed int32
+	var firstErr error
+	var errOnce sync.Once
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range jobs {
+				if atomic.LoadInt32(&failed) != 0 {
+					continue
+				}
+
+				var data []byte
+				var err error
+				if useCache {
+					data, err = storage.block(index)
+				} else {
+					data, err = storage.readBlock(index)
+				}
+				if err != nil {
+					errOnce.Do(func() { firstErr = err })
+					atomic.StoreInt32(&failed, 1)
+					continue
+				}
+
+				start := storage.offsets[index]
+				if start < off {
+					copy(p, data[off-start:])
+				} else {
+					copy(p[start-off:], data)
+				}
+			}
+		}()
+	}
+
+	for index := first; index <= last; index++ {
+		jobs <- index
+	}
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
+
 func (storage *ArchiveBlockStorage) inCurrentBlock(pos int64) bool {
 	if storage.CurrentBlockIndex < 0 {
 		return false
 	}
 	off := storage.CurrentBlockOffset
-	end := off + int64(storage.Blocks[storage.CurrentBlockIndex].UncompressedSize)
+	end := off + int64(len(storage.CurrentBlock))
 	return off <= pos && pos < end
 }
 
-func (storage *ArchiveBlockStorage) seekToBlock(pos int64) {
+// Returns the index of the block holding the virtual offset pos.
+func (storage *ArchiveBlockStorage) blockIndex(pos int64) int {
+	return sort.Search(len(storage.offsets), func(i int) bool {
+		return storage.offsets[i]+int64(storage.Blocks[i].UncompressedSize) > pos
+	})
+}
+
+// Returns the block holding the virtual offset pos and its offset, and makes
+// it the current block.
+func (storage *ArchiveBlockStorage) blockAt(pos int64) ([]byte, int64, error) {
+	storage.mu.Lock()
 	if storage.inCurrentBlock(pos) {
-		return
+		defer storage.mu.Unlock()
+		return storage.CurrentBlock, storage.CurrentBlockOffset, nil
+	}
+	storage.mu.Unlock()
+
+	index := storage.blockIndex(pos)
+	if index >= len(storage.Blocks) {
+		return nil, 0, io.EOF
+	}
+
+	data, err := storage.block(index)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	baseOffset := int64(0)
-	offset := int64(0)
-	found := false
-	for i, b := range storage.Blocks {
-		if offset+int64(b.UncompressedSize) > pos {
-			storage.CurrentBlockIndex = i
-			found = true
-			break
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	storage.CurrentBlockIndex = index
+	storage.CurrentBlockOffset = storage.offsets[index]
+	storage.CurrentBlock = data
+
+	return data, storage.offsets[index], nil
+}
+
+// Returns the decompressed block at index from the cache, or reads it. A
+// block is only decompressed once at a time: concurrent callers wait for the
+// running decompression and share its result.
+func (storage *ArchiveBlockStorage) block(index int) ([]byte, error) {
+	if storage.Cache != nil {
+		if data, found := storage.Cache.get(storage, index); found {
+			return data, nil
 		}
-		baseOffset += int64(b.CompressedSize)
-		offset += int64(b.UncompressedSize)
 	}
 
-	if !found {
-		storage.CurrentBlockIndex = -1
-		storage.CurrentBlock.Reset()
-		storage.CurrentBlock = nil
-		return
+	storage.mu.Lock()
+	if load, found := storage.loads[index]; found {
+		storage.mu.Unlock()
+		<-load.done
+		return load.data, load.err
+	}
+	load := &blockLoad{done: make(chan struct{})}
+	if storage.loads == nil {
+		storage.loads = make(map[int]*blockLoad)
+	}
+	storage.loads[index] = load
+	storage.mu.Unlock()
+
+	load.data, load.err = storage.readBlock(index)
+	if load.err == nil && storage.Cache != nil {
+		storage.Cache.add(storage, index, load.data)
 	}
 
-	storage.CurrentBlockOffset = offset
-	storage.Reader.SeekStart(storage.BaseOffset + baseOffset)
+	storage.mu.Lock()
+	delete(storage.loads, index)
+	storage.mu.Unlock()
+	close(load.done)
+
+	return load.data, load.err
+}
+
+// Reads and decompresses the block at index.
+// Errors are *FormatError at the file offset of the block.
+func (storage *ArchiveBlockStorage) readBlock(index int) ([]byte, error) {
+	block := storage.Blocks[index]
+	offset := storage.BaseOffset + storage.compressedOffsets[index]
+	if block.CompressedSize < 0 {
+		return nil, formatError(StageBlock, offset, fmt.Errorf("Invalid compressed size: %v", block.CompressedSize))
+	}
 
-	currentBlock := storage.Blocks[storage.CurrentBlockIndex]
-	compressed, _ := storage.Reader.Bytes(int64(currentBlock.CompressedSize))
-	if currentBlockB, err := currentBlock.Decompress(compressed); err != nil {
-		fmt.Println(err)
-	} else {
-		storage.CurrentBlock, _ = NewReader(currentBlockB)
+	compressed := make([]byte, block.CompressedSize)
+	if n, err := storage.Source.ReadAt(compressed, offset); n < len(compressed) {
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, formatError(StageBlock, offset, err)
 	}
+
+	data, err := block.decompress(compressed, storage.Limits.withDefaults())
+	if err != nil {
+		return nil, formatError(StageBlock, offset, err)
+	}
+
+	if len(data) != int(block.UncompressedSize) {
+		return nil, formatError(StageBlock, offset, fmt.Errorf("Block %v decompressed to %v bytes, expected %v", index, len(data), block.UncompressedSize))
+	}
+
+	return data, nil
 }
@@ -0,0 +1,231 @@
+package unity
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	lz4 "github.com/cloudflare/golz4"
+)
+
+// Splits data into chunks of chunkSize and compresses every other chunk
+// with LZ4HC.
+func makeBlockStorage(t *testing.T, data []byte, chunkSize int) *ArchiveBlockStorage {
+	blocks := []ArchiveBlockInfo{}
+	compressed := []byte{}
+	for i := 0; i*chunkSize < len(data); i++ {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := data[i*chunkSize : end]
+		block := ArchiveBlockInfo{UncompressedSize: int32(len(chunk))}
+		if i%2 == 0 {
+			out := make([]byte, lz4.CompressBound(chunk))
+			n, err := lz4.CompressHC(chunk, out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunk = out[:n]
+			block.Flags = CompressionLZ4HC
+		}
+		block.CompressedSize = int32(len(chunk))
+		blocks = append(blocks, block)
+		compressed = append(compressed, chunk...)
+	}
+
+	reader, _ := NewReader(append([]byte("header"), compressed...))
+	return NewArchiveBlockStorage(reader, 6, blocks)
+}
+
+func TestArchiveBlockStorage(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	storage := makeBlockStorage(t, data, 128)
+	if storage.Size() != int64(len(data)) {
+		t.Fatalf("Invalid virtual size. Got: %v Expected: %v", storage.Size(), len(data))
+	}
+
+	// Nodes spanning several blocks, sharing a block and ending at the end
+	ranges := [][2]int64{{0, 1000}, {100, 300}, {130, 10}, {140, 10}, {990, 10}, {127, 2}}
+	for _, r := range ranges {
+		p := make([]byte, r[1])
+		if _, err := storage.ReadAt(p, r[0]); err != nil {
+			t.Errorf("ReadAt(%v, %v): %v", r[0], r[1], err)
+		} else if !bytes.Equal(p, data[r[0]:r[0]+r[1]]) {
+			t.Errorf("ReadAt(%v, %v): Data mismatch", r[0], r[1])
+		}
+
+		section, err := ioutil.ReadAll(io.NewSectionReader(storage, r[0], r[1]))
+		if err != nil || !bytes.Equal(section, data[r[0]:r[0]+r[1]]) {
+			t.Errorf("Section(%v, %v): Data mismatch (%v)", r[0], r[1], err)
+		}
+	}
+
+	if _, err := storage.ReadAt(make([]byte, 20), 990); err != io.EOF {
+		t.Errorf("Expected EOF when reading past the end. Got: %v", err)
+	}
+
+	if _, err := storage.Seek(500, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := ioutil.ReadAll(storage)
+	if err != nil || !bytes.Equal(rest, data[500:]) {
+		t.Errorf("Read after seek: Data mismatch (%v)", err)
+	}
+}
+
+func TestBlockStorageLimits(t *testing.T) {
+	data := bytes.Repeat([]byte("limits"), 10000)
+	compressed, err := CompressLZMARaw(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := []ArchiveBlockInfo{{UncompressedSize: int32(len(data)), CompressedSize: int32(len(compressed)), Flags: CompressionLZMA}}
+
+	storage := NewArchiveBlockStorage(bytes.NewReader(compressed), 0, blocks)
+	storage.Limits = Limits{MaxAllocation: 1024}
+	if _, err = storage.ReadAt(make([]byte, 10), 0); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected a limit error. Got: %v", err)
+	}
+
+	storage = NewArchiveBlockStorage(bytes.NewReader(compressed), 0, blocks)
+	p := make([]byte, 10)
+	if _, err = storage.ReadAt(p, 6); err != nil || string(p) != "limitslimi" {
+		t.Errorf("Invalid data with the default limits: %q (%v)", p, err)
+	}
+}
+
+func TestDecompressParallel(t *testing.T) {
+	data := make([]byte, 10000)
+	for i := range data {
+		data[i] = byte(i * 13)
+	}
+
+	// Ranges over many blocks, starting and ending inside blocks
+	storage := makeBlockStorage(t, data, 128)
+	storage.Workers = 4
+	ranges := [][2]int64{{0, 10000}, {100, 5000}, {127, 2}, {9000, 1000}}
+	for _, r := range ranges {
+		p := make([]byte, r[1])
+		if _, err := storage.ReadAt(p, r[0]); err != nil {
+			t.Errorf("ReadAt(%v, %v): %v", r[0], r[1], err)
+		} else if !bytes.Equal(p, data[r[0]:r[0]+r[1]]) {
+			t.Errorf("ReadAt(%v, %v): Data mismatch", r[0], r[1])
+		}
+	}
+	if n, err := storage.ReadAt(make([]byte, 500), 9800); n != 200 || err != io.EOF {
+		t.Errorf("Expected 200 bytes and EOF when reading past the end. Got: %v, %v", n, err)
+	}
+
+	if err := storage.DecompressAll(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(storage.data, data) {
+		t.Error("DecompressAll: Data mismatch")
+	}
+	p := make([]byte, 300)
+	if _, err := storage.ReadAt(p, 1000); err != nil || !bytes.Equal(p, data[1000:1300]) {
+		t.Errorf("ReadAt after DecompressAll: Data mismatch (%v)", err)
+	}
+
+	// A corrupted block fails the whole range
+	storage = makeBlockStorage(t, data, 128)
+	storage.Workers = 4
+	storage.Blocks[40].Flags = CompressionLZMA
+	if err := storage.DecompressAll(); err == nil {
+		t.Error("Expected an error for a corrupted block")
+	} else if storage.data != nil {
+		t.Error("Data kept after a failed DecompressAll")
+	}
+}
+
+// Lets a read through only once another read is waiting, so reads that
+// don't run concurrently fail.
+type rendezvousReader struct {
+	io.ReaderAt
+	arrived chan struct{}
+}
+
+func (r *rendezvousReader) ReadAt(p []byte, off int64) (int, error) {
+	select {
+	case r.arrived <- struct{}{}:
+	case <-r.arrived:
+	case <-time.After(5 * time.Second):
+		return 0, errors.New("Reads not concurrent")
+	}
+	return r.ReaderAt.ReadAt(p, off)
+}
+
+// Counts reads, which wait until release is closed
+type gatedReader struct {
+	io.ReaderAt
+	release chan struct{}
+	reads   int32
+}
+
+func (r *gatedReader) ReadAt(p []byte, off int64) (int, error) {
+	atomic.AddInt32(&r.reads, 1)
+	<-r.release
+	return r.ReaderAt.ReadAt(p, off)
+}
+
+func TestConcurrentReadAt(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 11)
+	}
+
+	// Different blocks are read and decompressed at the same time
+	for _, cache := range []*BlockCache{nil, NewBlockCache(1 << 20)} {
+		storage := makeBlockStorage(t, data, 128)
+		storage.Cache = cache
+		storage.Source = &rendezvousReader{ReaderAt: storage.Source, arrived: make(chan struct{})}
+
+		var wg sync.WaitGroup
+		for _, off := range []int64{10, 300} {
+			wg.Add(1)
+			go func(off int64) {
+				defer wg.Done()
+				p := make([]byte, 20)
+				if _, err := storage.ReadAt(p, off); err != nil {
+					t.Errorf("ReadAt(%v): %v", off, err)
+				} else if !bytes.Equal(p, data[off:off+20]) {
+					t.Errorf("ReadAt(%v): Data mismatch", off)
+				}
+			}(off)
+		}
+		wg.Wait()
+	}
+
+	// Readers of the same block share one decompression
+	storage := makeBlockStorage(t, data, 128)
+	gated := &gatedReader{ReaderAt: storage.Source, release: make(chan struct{})}
+	storage.Source = gated
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(off int64) {
+			defer wg.Done()
+			p := make([]byte, 10)
+			if _, err := storage.ReadAt(p, off); err != nil || !bytes.Equal(p, data[off:off+10]) {
+				t.Errorf("ReadAt(%v): Data mismatch (%v)", off, err)
+			}
+		}(int64(i * 10))
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(gated.release)
+	wg.Wait()
+	if gated.reads != 1 {
+		t.Errorf("Expected one read of the shared block. Got: %v", gated.reads)
+	}
+}
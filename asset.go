@@ -1,13 +1,12 @@
 package unity
 
 import (
-	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"path/filepath"
 	"strings"
-
-	"github.com/itchio/lzma"
 )
 
 // https://docs.unity3d.com/530/Documentation/Manual/AssetBundleInternalStructure.html
@@ -18,62 +17,138 @@ type Asset struct {
 	Bundle         *Bundle
 	BundleOffset   int64
 	Name           string
+	Path           string // Location on disk of standalone files
 	Tree           *TypeMetadata
 	Types          map[int32]TypeTree
 	Objects        map[int64]ObjectInfo
+	PathIDs        []int64 // Object path IDs in file order
 	Adds           map[int64]int32
+	ScriptTypes    []ScriptType
 	AssetRefs      []*AssetRef
+	RefTypes       []*SerializedType // Format >= 20
+	UserInfo       string
 	IsLittleEndian bool
 	IsLoaded       bool
 	LongObjectIDs  bool
 	MetadataSize   uint32
-	FileSize       uint32
+	FileSize       int64
 	Format         uint32
-	DataOffset     uint32
+	DataOffset     int64
+
+	// Header fields kept for writing
+	reserved []byte
+	unknown  int64
+
+	// Object data replaced by SetObjectData
+	modified map[int64][]byte
+
+	// Serialized file data when Reader only holds the metadata
+	source io.ReaderAt
+	size   int64
+	closer io.Closer
+
+	// Limits and type database of a standalone file
+	options Options
 }
 
-func AssetFromBundle(bundle *Bundle, reader *Reader) *Asset {
-	a := Asset{
+// A script type referenced by the objects of a serialized file
+type ScriptType struct {
+	FileIndex int32
+	PathID    int64
+}
+
+func newAsset(bundle *Bundle) *Asset {
+	return &Asset{
 		Bundle:  bundle,
 		Adds:    make(map[int64]int32),
 		Objects: make(map[int64]ObjectInfo),
 		Types:   make(map[int32]TypeTree),
 	}
+}
+
+func AssetFromBundle(bundle *Bundle, reader *Reader) *Asset {
+	a := newAsset(bundle)
+	a.Reader = reader
+	a.BundleOffset = reader.Tell()
 
-	offset := reader.Tell()
+	return a
+}
 
-	if bundle.Signature == SignatureFS {
-		a.Reader = reader
-		a.BundleOffset = offset
-		return &a
+// Loads a standalone serialized file such as level0, sharedassets0.assets,
+// resources.assets or globalgamemanagers. The file is mapped into memory
+// where supported until Close. Files split into .splitN parts are joined in
+// place and keep their files open until Close.
+func AssetFromFile(path string) (*Asset, error) {
+	if isSplitFile(path) {
+		return OpenAssetFile(path)
 	}
 
-	if bundle.Compressed() {
-		ofs := reader.Tell()
-		raw, _ := reader.Bytes(reader.Remaining())
-		decompressed := lzma.NewReader(bytes.NewReader(raw))
-		b, err := ioutil.ReadAll(decompressed)
-		if err != nil {
-			return nil
-		}
-		a.Reader, _ = NewReader(b)
-		a.BundleOffset = 0
-		reader.SeekStart(ofs)
-	} else {
-		a.Name, _ = reader.StringNull()
-		headerSize, _ := reader.Uint32()
-		_, _ = reader.Uint32()
-		a.BundleOffset = offset + int64(headerSize) - 4
-		if a.IsResource() {
-			a.BundleOffset -= int64(len(a.Name))
-		}
-		a.Reader = reader
+	reader, err := NewMappedReader(path)
+	if err != nil {
+		return nil, err
+	}
+
+	a := newAsset(nil)
+	a.Name = filepath.Base(path)
+	a.Path = path
+	a.Reader = reader
+
+	if err = a.LoadFromBuffer(); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	a.closer = reader
+
+	return a, nil
+}
+
+// Opens the standalone serialized file at path, keeping the file open until
+// Close. Only the metadata is read up front.
+func OpenAssetFile(path string) (*Asset, error) {
+	return openAssetFile(path, nil)
+}
+
+// Opens a standalone serialized file with the limits and type database of
+// opts.
+func openAssetFile(path string, opts *Options) (*Asset, error) {
+	r, size, err := openFile(path)
+	if err != nil {
+		return nil, err
 	}
 
-	return &a
+	base, _ := splitBase(path)
+	a := newAsset(nil)
+	if opts != nil {
+		a.options = *opts
+	}
+	a.Name = filepath.Base(base)
+	a.Path = base
+	a.source = r
+	a.size = size
+
+	if err = a.LoadFromBuffer(); err != nil {
+		r.Close()
+		return nil, err
+	}
+	a.closer = r
+
+	return a, nil
 }
 
-//func AssetFromFile()
+// Loads a standalone serialized file of size bytes from r. Only the metadata
+// is read; object data is read from r when requested.
+func OpenAsset(r io.ReaderAt, size int64, name string) (*Asset, error) {
+	a := newAsset(nil)
+	a.Name = name
+	a.source = r
+	a.size = size
+
+	if err := a.LoadFromBuffer(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
 
 func (a *Asset) String() string {
 	return fmt.Sprintf("%#v", a)
@@ -91,8 +166,10 @@ func (a *Asset) ReadID(reader *Reader) (int64, error) {
 	}
 }
 
+// Reports whether the asset is a streamed data file (.resource or .resS)
+// rather than a serialized file.
 func (a *Asset) IsResource() bool {
-	return strings.HasSuffix(a.Name, ".resource")
+	return strings.HasSuffix(a.Name, ".resource") || strings.HasSuffix(a.Name, ".resS")
 }
 
 func (a *Asset) LoadObjects(sig string) error {
@@ -109,80 +186,263 @@ func (a *Asset) Load(sig string) error {
 		return nil
 	}
 
-	if sig == SignatureFS || sig == SignatureRaw {
+	switch sig {
+	case SignatureFS, SignatureArchive, SignatureRaw, SignatureWeb, SignatureWebData:
 		return a.LoadFromBuffer()
-	} else {
-		return fmt.Errorf("unity.Asset.Load: Signature not supported: %v", sig)
 	}
+
+	return fmt.Errorf("unity.Asset.Load: Signature not supported: %v", sig)
+}
+
+// Reports whether header, the start of a file of size bytes, is a valid
+// serialized file header.
+func IsSerializedFile(header []byte, size int64) bool {
+	if len(header) < 20 {
+		return false
+	}
+
+	be := binary.BigEndian
+	metadataSize := int64(be.Uint32(header))
+	fileSize := int64(be.Uint32(header[4:]))
+	format := be.Uint32(header[8:])
+	dataOffset := int64(be.Uint32(header[12:]))
+
+	if format < 1 || format > 50 {
+		return false
+	}
+
+	if format >= 22 {
+		if len(header) < 40 {
+			return false
+		}
+		metadataSize = int64(be.Uint32(header[20:]))
+		fileSize = int64(be.Uint64(header[24:]))
+		dataOffset = int64(be.Uint64(header[32:]))
+	}
+
+	if fileSize != size || metadataSize > fileSize {
+		return false
+	}
+
+	return format < 9 || dataOffset <= fileSize
+}
+
+// Reads the serialized file header and metadata from the asset source. The
+// object data after the metadata is left in the source.
+func (a *Asset) readMetadata() error {
+	if a.source == nil {
+		return errors.New("unity.Asset.readMetadata: No data source")
+	}
+
+	header := make([]byte, 48)
+	n, err := a.source.ReadAt(header, 0)
+	if n < 20 {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	// The metadata precedes the object data since format 9
+	size := a.size
+	format := binary.BigEndian.Uint32(header[8:])
+	if format >= 9 {
+		dataOffset := int64(binary.BigEndian.Uint32(header[12:]))
+		if format >= 22 && n >= 40 {
+			dataOffset = int64(binary.BigEndian.Uint64(header[32:]))
+		}
+		if dataOffset > 0 && dataOffset < size {
+			size = dataOffset
+		}
+	}
+
+	if err = a.limits().checkAllocation("metadata", size); err != nil {
+		return err
+	}
+	buf := make([]byte, size)
+	if n, err = a.source.ReadAt(buf, 0); int64(n) < size {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	a.Reader, _ = NewReader(buf)
+	a.BundleOffset = 0
+
+	return nil
 }
 
 func (a *Asset) LoadFromBuffer() (err error) {
+	if a.Reader == nil {
+		if err = a.readMetadata(); err != nil {
+			return a.setErrorLocation(formatError(StageHeader, 0, err))
+		}
+	}
+
 	if _, err := a.Reader.SeekStart(a.BundleOffset); err != nil {
-		return fmt.Errorf("unity.Asset.LoadFromBuffer: Couldn't seek to offset %v", a.BundleOffset)
+		return a.formatError(StageHeader, err)
+	}
+	a.Reader.ChangeEndian(false)
+	if a.MetadataSize, err = a.Reader.Uint32(); err != nil {
+		return a.formatError(StageHeader, err)
 	}
-	a.MetadataSize, err = a.Reader.Uint32()
-	a.FileSize, _ = a.Reader.Uint32()
-	a.Format, _ = a.Reader.Uint32()
-	a.DataOffset, _ = a.Reader.Uint32()
+	fileSize, err := a.Reader.Uint32()
+	if err != nil {
+		return a.formatError(StageHeader, err)
+	}
+	if a.Format, err = a.Reader.Uint32(); err != nil {
+		return a.formatError(StageHeader, err)
+	}
+	dataOffset, err := a.Reader.Uint32()
+	if err != nil {
+		return a.formatError(StageHeader, err)
+	}
+	a.FileSize = int64(fileSize)
+	a.DataOffset = int64(dataOffset)
 
 	if a.Format >= 9 {
-		endian, _ := a.Reader.Uint32()
+		endian, err := a.Reader.Uint8()
+		if err != nil {
+			return a.formatError(StageHeader, err)
+		}
+		a.IsLittleEndian = endian == 0
+		if a.reserved, err = a.Reader.Bytes(3); err != nil {
+			return a.formatError(StageHeader, err)
+		}
+
+		if a.Format >= 22 {
+			if a.MetadataSize, err = a.Reader.Uint32(); err != nil {
+				return a.formatError(StageHeader, err)
+			}
+			if a.FileSize, err = a.Reader.Int64(); err != nil {
+				return a.formatError(StageHeader, err)
+			}
+			if a.DataOffset, err = a.Reader.Int64(); err != nil {
+				return a.formatError(StageHeader, err)
+			}
+			if a.unknown, err = a.Reader.Int64(); err != nil {
+				return a.formatError(StageHeader, err)
+			}
+		}
+
+		a.Reader.ChangeEndian(a.IsLittleEndian)
+	} else {
+		// Older formats store the metadata at the end of the file
+		if _, err = a.Reader.SeekStart(a.BundleOffset + a.FileSize - int64(a.MetadataSize)); err != nil {
+			return a.formatError(StageHeader, fmt.Errorf("Couldn't seek to metadata at %v", a.FileSize-int64(a.MetadataSize)))
+		}
+		endian, err := a.Reader.Uint8()
+		if err != nil {
+			return a.formatError(StageMetadata, err)
+		}
 		a.IsLittleEndian = endian == 0
 		a.Reader.ChangeEndian(a.IsLittleEndian)
 	}
 
-	if a.Tree, err = ReadTypeMetadata(a.Reader, a.IsLittleEndian, a.Format); err != nil {
-		return err
+	limits := a.limits()
+	if a.Tree, err = readTypeMetadata(a.Reader, a.IsLittleEndian, a.Format, limits); err != nil {
+		return a.formatError(StageMetadata, err)
 	}
 
 	if a.Format >= 7 && a.Format < 14 {
-		longObjectIds, _ := a.Reader.Uint32()
+		longObjectIds, err := a.Reader.Uint32()
+		if err != nil {
+			return a.formatError(StageMetadata, err)
+		}
 		a.LongObjectIDs = longObjectIds != 0
 	}
 
-	numObjects, _ := a.Reader.Uint32()
+	numObjects, err := a.Reader.Uint32()
+	if err == nil {
+		err = limits.checkCount("object", int64(numObjects))
+	}
+	if err != nil {
+		return a.formatError(StageObjectInfo, err)
+	}
 
 	for i := uint32(0); i < numObjects; i++ {
 		if a.Format >= 14 {
-			a.Reader.Align()
+			if _, err = a.Reader.Align(); err != nil {
+				return a.formatError(StageObjectInfo, err)
+			}
 		}
 
 		obj, err := ReadObjectInfo(a, a.Reader)
 		if err != nil {
-			return err
+			return a.formatError(StageObjectInfo, err)
 		}
 
-		a.registerObject(obj)
+		if err = a.registerObject(obj); err != nil {
+			return a.formatError(StageObjectInfo, err)
+		}
+		a.PathIDs = append(a.PathIDs, obj.PathID)
 	}
 
 	if a.Format >= 11 {
-		numAdds, _ := a.Reader.Uint32()
+		numAdds, err := a.Reader.Uint32()
+		if err == nil {
+			err = limits.checkCount("script type", int64(numAdds))
+		}
+		if err != nil {
+			return a.formatError(StageMetadata, err)
+		}
 		for i := uint32(0); i < numAdds; i++ {
+			var add ScriptType
+			if add.FileIndex, err = a.Reader.Int32(); err != nil {
+				return a.formatError(StageMetadata, err)
+			}
+
 			if a.Format >= 14 {
-				a.Reader.Align()
+				if _, err = a.Reader.Align(); err != nil {
+					return a.formatError(StageMetadata, err)
+				}
 			}
 
-			id, _ := a.ReadID(a.Reader)
-			add, _ := a.Reader.Int32()
-			a.Adds[id] = add
+			if add.PathID, err = a.ReadID(a.Reader); err != nil {
+				return a.formatError(StageMetadata, err)
+			}
+			a.Adds[add.PathID] = add.FileIndex
+			a.ScriptTypes = append(a.ScriptTypes, add)
 		}
 	}
 
 	if a.Format >= 6 {
-		numRefs, _ := a.Reader.Uint32()
+		numRefs, err := a.Reader.Uint32()
+		if err == nil {
+			err = limits.checkCount("external", int64(numRefs))
+		}
+		if err != nil {
+			return a.formatError(StageExternals, err)
+		}
 		for i := uint32(0); i < numRefs; i++ {
 			ref, err := ReadAssetRef(a.Reader, a.Format, a.IsLittleEndian)
 			if err != nil {
-				return err
+				return a.formatError(StageExternals, err)
 			}
 			a.AssetRefs = append(a.AssetRefs, ref)
 		}
 	}
 
-	if unknownStr, err := a.Reader.StringNull(); err != nil {
-		return err
-	} else if unknownStr != "" {
-		return errors.New("unity.Asset.LoadFromBuffer: Ending string not empty.")
+	if a.Format >= 20 {
+		numRefTypes, err := a.Reader.Int32()
+		if err == nil {
+			err = limits.checkCount("type", int64(numRefTypes))
+		}
+		if err != nil {
+			return a.formatError(StageMetadata, err)
+		}
+		for i := int32(0); i < numRefTypes; i++ {
+			st, err := readSerializedType(a.Reader, a.IsLittleEndian, a.Format, a.Tree.HasTypeTrees, true, commonStrings(a.Tree.GeneratorVersion), limits)
+			if err != nil {
+				return a.formatError(StageMetadata, err)
+			}
+			a.RefTypes = append(a.RefTypes, st)
+		}
+	}
+
+	if a.UserInfo, err = a.Reader.StringNull(); err != nil {
+		return a.formatError(StageMetadata, err)
 	}
 
 	a.IsLoaded = true
@@ -190,18 +450,145 @@ func (a *Asset) LoadFromBuffer() (err error) {
 	return nil
 }
 
+// Returns the limits of the bundle holding the asset or of a standalone
+// asset, or DefaultLimits.
+func (a *Asset) limits() Limits {
+	if a.Bundle != nil {
+		return a.Bundle.options.Limits.withDefaults()
+	}
+	return a.options.Limits.withDefaults()
+}
+
+// Returns the type database of the bundle holding the asset or of a
+// standalone asset, or DefaultTypeDatabase.
+func (a *Asset) typeDatabase() *TypeDatabase {
+	if a.Bundle != nil && a.Bundle.options.TypeDatabase != nil {
+		return a.Bundle.options.TypeDatabase
+	}
+	if a.Bundle == nil && a.options.TypeDatabase != nil {
+		return a.options.TypeDatabase
+	}
+	return DefaultTypeDatabase
+}
+
+// Finds the type tree of an object in the type database, for files without
+// type trees.
+func (a *Asset) lookupType(obj *ObjectInfo) (*TypeTree, bool) {
+	db := a.typeDatabase()
+	if db == nil {
+		return nil, false
+	}
+
+	classID := obj.TypeID
+	var hash []byte
+	if a.Format >= 16 {
+		st := a.Tree.SerializedTypes[obj.TypeIndex]
+		classID = st.ClassID
+		hash = st.OldTypeHash
+	} else {
+		for _, st := range a.Tree.SerializedTypes {
+			if st.ClassID == classID {
+				hash = st.OldTypeHash
+				break
+			}
+		}
+	}
+
+	return db.Lookup(a.unityVersion(), classID, hash)
+}
+
+// Returns the Unity version that built the file. Stripped files store 0.0.0
+// instead, and the version of their bundle is used.
+func (a *Asset) unityVersion() string {
+	version := a.Tree.GeneratorVersion
+	if v, ok := parseUnityVersion(version); (!ok || v == [3]int{}) && a.Bundle != nil {
+		return a.Bundle.GeneratorVersion
+	}
+	return version
+}
+
+// Wraps err as a *FormatError at the current metadata offset.
+func (a *Asset) formatError(stage string, err error) error {
+	return a.setErrorLocation(formatError(stage, a.Reader.Tell()-a.BundleOffset, err))
+}
+
+// Sets the file and bundle node of a *FormatError in err.
+func (a *Asset) setErrorLocation(err error) error {
+	if a.Bundle != nil {
+		return setErrorLocation(err, a.Bundle.Path, a.Name)
+	}
+	if a.Path != "" {
+		return setErrorLocation(err, a.Path, "")
+	}
+	return setErrorLocation(err, a.Name, "")
+}
+
 func (a *Asset) registerObject(obj *ObjectInfo) error {
 	if tree, found := a.Tree.TypeTrees[obj.TypeID]; found {
 		a.Types[obj.TypeID] = tree
-	} else if tree, found = a.Types[obj.TypeID]; !found {
-		// TODO: default metadata
+	} else if _, found = a.Types[obj.TypeID]; !found {
+		if tree, found := a.lookupType(obj); found {
+			a.Types[obj.TypeID] = *tree
+		}
 	}
 
 	if _, found := a.Objects[obj.PathID]; found {
-		return fmt.Errorf("unity.Asset.registerObject: Duplicate asset object: %v", a.Objects[obj.PathID])
+		return fmt.Errorf("Duplicate asset object: %v", obj.PathID)
 	}
 
 	a.Objects[obj.PathID] = *obj
 
 	return nil
 }
+
+// Releases the files held by an asset opened from disk.
+func (a *Asset) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+
+	err := a.closer.Close()
+	a.closer = nil
+	a.source = nil
+	return err
+}
+
+// Returns the serialized data of the object with the given path ID. Data of
+// memory mapped or in-memory files is a slice of it, and data of a mapped
+// file is only valid until Close.
+func (a *Asset) ObjectData(pathID int64) ([]byte, error) {
+	obj, found := a.Objects[pathID]
+	if !found {
+		return nil, fmt.Errorf("unity.Asset.ObjectData: Object not found: %v", pathID)
+	}
+
+	if data, found := a.modified[pathID]; found {
+		return data, nil
+	}
+
+	offset := a.DataOffset + int64(obj.DataOffset)
+	size := int64(obj.Size)
+
+	if a.source != nil {
+		if offset+size > a.size {
+			return nil, fmt.Errorf("unity.Asset.ObjectData: Object %v out of bounds (%v+%v > %v)", pathID, offset, size, a.size)
+		}
+		if source, ok := a.source.(memorySource); ok {
+			return source.slice(offset, size)
+		}
+		if err := a.limits().checkAllocation("object", size); err != nil {
+			return nil, err
+		}
+		data := make([]byte, size)
+		if _, err := a.source.ReadAt(data, offset); err != nil && err != io.EOF {
+			return nil, a.setErrorLocation(err)
+		}
+		return data, nil
+	}
+
+	offset += a.BundleOffset
+	if offset < 0 || offset+size > a.Reader.Len() {
+		return nil, fmt.Errorf("unity.Asset.ObjectData: Object %v out of bounds (%v+%v > %v)", pathID, offset, size, a.Reader.Len())
+	}
+	return a.Reader.buf[offset : offset+size], nil
+}
@@ -0,0 +1,150 @@
+package unity
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zklm/unity/engine"
+)
+
+// Returns the serialized file stored in the first node of a test bundle.
+func readTestSerializedFile(t testing.TB, path string) []byte {
+	bundle, err := ReadBundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := bundle.OpenNode(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadAll(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestAssetFromFile(t *testing.T) {
+	data := readTestSerializedFile(t, "test/main_dxt1_bc1.unity3d")
+
+	dir, err := ioutil.TempDir("", "unity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sharedassets0.assets")
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fromFile, err := AssetFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fromReader, err := OpenAsset(bytes.NewReader(data), int64(len(data)), "sharedassets0.assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, asset := range []*Asset{fromFile, fromReader} {
+		if asset.Name != "sharedassets0.assets" {
+			t.Errorf("Invalid asset name. Got: %s", asset.Name)
+		}
+
+		if len(asset.Objects) != 4 {
+			t.Errorf("Invalid object count. Got: %v Expected: 4", len(asset.Objects))
+		}
+
+		for pathID, obj := range asset.Objects {
+			objData, err := asset.ObjectData(pathID)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			start := asset.DataOffset + int64(obj.DataOffset)
+			if !bytes.Equal(objData, data[start:start+int64(obj.Size)]) {
+				t.Errorf("Object %v data mismatch", pathID)
+			}
+		}
+	}
+}
+
+func TestReadStreamed(t *testing.T) {
+	data := readTestSerializedFile(t, "test/main_dxt1_bc1.unity3d")
+	streamed := []byte("0123456789")
+
+	// Sibling node of a bundle
+	cab := "CAB-ba01e3c16ba268ec36e9543a39dc83ad"
+	f, err := ioutil.TempFile("", "unityraw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(makeRawBundle(t, SignatureRaw, []string{cab, cab + ".resS"}, [][]byte{data, streamed}))
+	f.Close()
+
+	bundle, err := ReadBundle(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bundle.Assets[1].IsResource() {
+		t.Error("Expected .resS node to be a resource")
+	}
+
+	got, err := bundle.Assets[0].ReadStreamingInfo(engine.StreamingInfo{Offset: 2, Size: 4, Path: "archive:/" + cab + "/" + cab + ".resS"})
+	if err != nil {
+		t.Error(err)
+	} else if string(got) != "2345" {
+		t.Errorf("Invalid streamed data. Got: %q Expected: %q", got, "2345")
+	}
+
+	// File next to a standalone asset
+	dir, err := ioutil.TempDir("", "unity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Mkdir(filepath.Join(dir, "Data"), 0755)
+	path := filepath.Join(dir, "Data", "sharedassets0.assets")
+	ioutil.WriteFile(path, data, 0644)
+	ioutil.WriteFile(path+".resS", streamed, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "outside.resS"), streamed, 0644)
+
+	asset, err := AssetFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = asset.ReadStreamedResource(engine.StreamedResource{Source: "sharedassets0.assets.resS", Offset: 5, Size: 5})
+	if err != nil {
+		t.Error(err)
+	} else if string(got) != "56789" {
+		t.Errorf("Invalid streamed data. Got: %q Expected: %q", got, "56789")
+	}
+
+	if _, err = asset.ReadStreamed("sharedassets0.assets.resS", 8, 5); err == nil {
+		t.Error("Expected an error for a range past the end of the file")
+	}
+	if _, err = asset.ReadStreamed("missing.resS", 0, 1); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+
+	// Paths outside the asset directory are only looked up by file name
+	for _, streamPath := range []string{"../outside.resS", filepath.Join(dir, "outside.resS"), ".."} {
+		if _, err = asset.ReadStreamed(streamPath, 0, 1); err == nil {
+			t.Errorf("Expected an error for %v", streamPath)
+		}
+	}
+	if got, err = asset.ReadStreamed("../Other/sharedassets0.assets.resS", 0, 2); err != nil || string(got) != "01" {
+		t.Errorf("Invalid streamed data. Got: %q (%v)", got, err)
+	}
+}
@@ -28,3 +28,10 @@ func ReadAssetRef(reader *Reader, format uint32, isLittleEndian bool) (ref *Asse
 
 	return
 }
+
+func (ref *AssetRef) write(w *Writer) {
+	w.StringNull(ref.AssetPath)
+	w.Write(ref.GUID)
+	w.Int32(ref.Type)
+	w.StringNull(ref.FilePath)
+}
@@ -0,0 +1,247 @@
+package unity
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Replaces the data of the object with the given path ID. WriteTo lays out
+// the object data again when any object was replaced.
+func (a *Asset) SetObjectData(pathID int64, data []byte) error {
+	if _, found := a.Objects[pathID]; !found {
+		return fmt.Errorf("unity.Asset.SetObjectData: Object not found: %v", pathID)
+	}
+
+	if a.modified == nil {
+		a.modified = make(map[int64][]byte)
+	}
+	a.modified[pathID] = data
+
+	return nil
+}
+
+// Writes the asset as a serialized file in its format version. The type
+// trees are left out when Tree.HasTypeTrees is unset. An unmodified asset
+// is written back byte for byte.
+func (a *Asset) WriteTo(w io.Writer) (int64, error) {
+	if !a.IsLoaded || a.Tree == nil {
+		return 0, errors.New("unity.Asset.WriteTo: Asset not loaded")
+	}
+	if a.IsResource() {
+		return 0, errors.New("unity.Asset.WriteTo: Not a serialized file")
+	}
+
+	objects := make([]ObjectInfo, len(a.PathIDs))
+	for i, pathID := range a.PathIDs {
+		objects[i] = a.Objects[pathID]
+		if data, found := a.modified[pathID]; found {
+			objects[i].Size = uint32(len(data))
+		}
+	}
+
+	// Objects keep their offsets unless some data was replaced
+	if len(a.modified) > 0 {
+		offset := int64(0)
+		for i := range objects {
+			offset = (offset + 7) &^ 7
+			objects[i].DataOffset = offset
+			offset += int64(objects[i].Size)
+		}
+	}
+
+	metadata, err := a.writeMetadata(objects)
+	if err != nil {
+		return 0, err
+	}
+
+	// Object data in data order, with zeros between objects
+	order := make([]int, len(objects))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return objects[order[i]].DataOffset < objects[order[j]].DataOffset
+	})
+
+	dataSize := int64(0)
+	for _, i := range order {
+		if objects[i].DataOffset < dataSize {
+			return 0, fmt.Errorf("unity.Asset.WriteTo: Object %v overlaps the previous object", objects[i].PathID)
+		}
+		dataSize = objects[i].DataOffset + int64(objects[i].Size)
+	}
+
+	headerSize := int64(16)
+	if a.Format >= 22 {
+		headerSize = 48
+	} else if a.Format >= 9 {
+		headerSize = 20
+	}
+
+	var metadataSize, dataOffset, fileSize int64
+	if a.Format >= 9 {
+		metadataSize = int64(len(metadata))
+		dataOffset = a.DataOffset
+		if headerSize+metadataSize > dataOffset {
+			dataOffset = (headerSize + metadataSize + 15) &^ 15
+		}
+		fileSize = dataOffset + dataSize
+	} else {
+		// The metadata follows the object data, starting with the endianness
+		metadataSize = int64(len(metadata)) + 1
+		dataOffset = a.DataOffset
+		if dataOffset < headerSize {
+			dataOffset = headerSize
+		}
+		fileSize = dataOffset + dataSize + metadataSize
+	}
+	if len(a.modified) == 0 && a.FileSize > fileSize {
+		fileSize = a.FileSize
+	}
+
+	header := NewWriter()
+	if a.Format >= 22 {
+		header.Uint32(0)
+		header.Uint32(0)
+		header.Uint32(a.Format)
+		header.Uint32(0)
+	} else {
+		header.Uint32(uint32(metadataSize))
+		header.Uint32(uint32(fileSize))
+		header.Uint32(a.Format)
+		header.Uint32(uint32(dataOffset))
+	}
+	if a.Format >= 9 {
+		header.Uint8(a.endianFlag())
+		if len(a.reserved) == 3 {
+			header.Write(a.reserved)
+		} else {
+			header.Write(make([]byte, 3))
+		}
+	}
+	if a.Format >= 22 {
+		header.Uint32(uint32(metadataSize))
+		header.Int64(fileSize)
+		header.Int64(dataOffset)
+		header.Int64(a.unknown)
+	}
+
+	cw := &countWriter{w: w}
+	cw.write(header.Data())
+	if a.Format >= 9 {
+		cw.write(metadata)
+	}
+	cw.pad(dataOffset)
+
+	for _, i := range order {
+		data, err := a.ObjectData(objects[i].PathID)
+		if err != nil {
+			return cw.n, err
+		}
+		cw.pad(dataOffset + objects[i].DataOffset)
+		cw.write(data)
+	}
+
+	if a.Format < 9 {
+		cw.pad(fileSize - metadataSize)
+		cw.write([]byte{a.endianFlag()})
+		cw.write(metadata)
+	}
+	cw.pad(fileSize)
+
+	return cw.n, cw.err
+}
+
+// Serializes the metadata following the header: types, object table,
+// script types, external references, referenced types and user info.
+func (a *Asset) writeMetadata(objects []ObjectInfo) ([]byte, error) {
+	w := NewWriter()
+	w.ChangeEndian(a.IsLittleEndian)
+
+	if err := a.Tree.write(w, a.Format); err != nil {
+		return nil, err
+	}
+
+	if a.Format >= 7 && a.Format < 14 {
+		if a.LongObjectIDs {
+			w.Uint32(1)
+		} else {
+			w.Uint32(0)
+		}
+	}
+
+	// The header size is a multiple of 4, so alignment within the metadata
+	// matches alignment within the file
+	w.Int32(int32(len(objects)))
+	for i := range objects {
+		if a.Format >= 14 {
+			w.Align()
+		}
+		objects[i].write(a, w)
+	}
+
+	if a.Format >= 11 {
+		w.Int32(int32(len(a.ScriptTypes)))
+		for _, add := range a.ScriptTypes {
+			w.Int32(add.FileIndex)
+			if a.Format >= 14 {
+				w.Align()
+				w.Int64(add.PathID)
+			} else {
+				w.Int32(int32(add.PathID))
+			}
+		}
+	}
+
+	if a.Format >= 6 {
+		w.Int32(int32(len(a.AssetRefs)))
+		for _, ref := range a.AssetRefs {
+			ref.write(w)
+		}
+	}
+
+	if a.Format >= 20 {
+		w.Int32(int32(len(a.RefTypes)))
+		for _, st := range a.RefTypes {
+			if err := writeSerializedType(w, st, a.Format, a.Tree.HasTypeTrees, true, commonStrings(a.Tree.GeneratorVersion)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	w.StringNull(a.UserInfo)
+
+	return w.Data(), nil
+}
+
+func (a *Asset) endianFlag() byte {
+	if a.IsLittleEndian {
+		return 0
+	}
+	return 1
+}
+
+// Counts the bytes written and keeps the first error
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countWriter) write(p []byte) {
+	if cw.err != nil {
+		return
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+}
+
+// Writes zeros up to offset
+func (cw *countWriter) pad(offset int64) {
+	if offset > cw.n {
+		cw.write(make([]byte, offset-cw.n))
+	}
+}
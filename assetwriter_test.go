@@ -0,0 +1,159 @@
+package unity
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWriteAsset(t *testing.T) {
+	for _, path := range []string{"test/20147_cs_h", "test/main_dxt1_bc1.unity3d"} {
+		data := readTestSerializedFile(t, path)
+		asset, err := OpenAsset(bytes.NewReader(data), int64(len(data)), "CAB")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := &bytes.Buffer{}
+		if n, err := asset.WriteTo(buf); err != nil {
+			t.Errorf("%v: %v", path, err)
+			continue
+		} else if n != int64(buf.Len()) {
+			t.Errorf("%v: Invalid written size. Got: %v Expected: %v", path, n, buf.Len())
+		}
+		if !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("%v: Round trip mismatch. Got %v bytes, expected %v", path, buf.Len(), len(data))
+		}
+
+		// Replaced object data moves the following objects
+		pathID := asset.PathIDs[0]
+		replaced := []byte("replaced")
+		if err = asset.SetObjectData(pathID, replaced); err != nil {
+			t.Fatal(err)
+		}
+		buf.Reset()
+		if _, err = asset.WriteTo(buf); err != nil {
+			t.Errorf("%v: %v", path, err)
+			continue
+		}
+
+		written, err := OpenAsset(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "CAB")
+		if err != nil {
+			t.Errorf("%v: %v", path, err)
+			continue
+		}
+		if written.FileSize != int64(buf.Len()) {
+			t.Errorf("%v: Invalid file size. Got: %v Expected: %v", path, written.FileSize, buf.Len())
+		}
+		if len(written.Objects) != len(asset.Objects) {
+			t.Errorf("%v: Invalid object count. Got: %v Expected: %v", path, len(written.Objects), len(asset.Objects))
+		}
+		for _, id := range asset.PathIDs {
+			expected, _ := asset.ObjectData(id)
+			got, err := written.ObjectData(id)
+			if err != nil {
+				t.Error(err)
+			} else if !bytes.Equal(got, expected) {
+				t.Errorf("%v: Object %v data mismatch", path, id)
+			}
+			if written.Objects[id].TypeID != asset.Objects[id].TypeID {
+				t.Errorf("%v: Object %v type mismatch. Got: %v Expected: %v", path, id, written.Objects[id].TypeID, asset.Objects[id].TypeID)
+			}
+		}
+
+		// Type trees can be left out
+		asset.Tree.HasTypeTrees = false
+		buf.Reset()
+		if _, err = asset.WriteTo(buf); err != nil {
+			t.Errorf("%v: %v", path, err)
+			continue
+		}
+		stripped, err := OpenAsset(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "CAB")
+		if err != nil {
+			t.Errorf("%v: %v", path, err)
+		} else if stripped.Tree.HasTypeTrees || len(stripped.Objects) != len(asset.Objects) {
+			t.Errorf("%v: Invalid stripped asset. Type trees: %v Objects: %v", path, stripped.Tree.HasTypeTrees, len(stripped.Objects))
+		}
+	}
+}
+
+// The sample files are format 15 and 17. Files of other formats are written
+// from them, then must decode to the same objects and be written back byte
+// for byte.
+func TestWriteAssetFormats(t *testing.T) {
+	data := readTestSerializedFile(t, "test/main_dxt1_bc1.unity3d")
+	for _, format := range []uint32{8, 9, 10, 11, 14, 19, 20, 21, 22} {
+		asset, err := OpenAsset(bytes.NewReader(data), int64(len(data)), "CAB")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := make(map[int64]*Struct)
+		for _, pathID := range asset.PathIDs {
+			if expected[pathID], err = asset.ReadObject(pathID); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		asset.Format = format
+		asset.LongObjectIDs = format >= 7 && format < 14
+		types := asset.Tree.SerializedTypes
+		types[0].Tree.Children[0].RefTypeHash = 0x123456789
+		types[0].Dependencies = []int32{1}
+		asset.RefTypes = []*SerializedType{{
+			ClassID:         int32(MonoBehaviour),
+			ScriptTypeIndex: 0,
+			ScriptID:        bytes.Repeat([]byte{1}, 16),
+			OldTypeHash:     bytes.Repeat([]byte{2}, 16),
+			Tree:            &TypeTree{Type: "Ref", Name: "Base", Size: 4, Index: 0},
+			ClassName:       "Ref",
+			Namespace:       "Test",
+			AssemblyName:    "Assembly-CSharp.dll",
+		}}
+
+		buf := &bytes.Buffer{}
+		if _, err = asset.WriteTo(buf); err != nil {
+			t.Errorf("Format %v: %v", format, err)
+			continue
+		}
+		written, err := OpenAsset(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "CAB")
+		if err != nil {
+			t.Errorf("Format %v: %v", format, err)
+			continue
+		}
+		if written.Format != format || len(written.Objects) != len(asset.Objects) {
+			t.Errorf("Format %v: Read format %v with %v objects", format, written.Format, len(written.Objects))
+			continue
+		}
+		for _, pathID := range asset.PathIDs {
+			got, err := written.ReadObject(pathID)
+			if err != nil {
+				t.Errorf("Format %v: Object %v: %v", format, pathID, err)
+			} else if !reflect.DeepEqual(got, expected[pathID]) {
+				t.Errorf("Format %v: Object %v mismatch", format, pathID)
+			}
+		}
+
+		// Fields of newer formats
+		st := written.Tree.SerializedTypes[0]
+		if hash := st.Tree.Children[0].RefTypeHash; (format >= 19) != (hash == 0x123456789) {
+			t.Errorf("Format %v: Invalid RefTypeHash %x", format, hash)
+		}
+		if (format >= 21) != reflect.DeepEqual(st.Dependencies, []int32{1}) {
+			t.Errorf("Format %v: Invalid dependencies %v", format, st.Dependencies)
+		}
+		if format >= 20 {
+			if len(written.RefTypes) != 1 || written.RefTypes[0].Tree.Type != "Ref" || !bytes.Equal(written.RefTypes[0].ScriptID, asset.RefTypes[0].ScriptID) {
+				t.Errorf("Format %v: Invalid referenced types %+v", format, written.RefTypes)
+			} else if ref := written.RefTypes[0]; (format >= 21) != (ref.ClassName == "Ref" && ref.Namespace == "Test" && ref.AssemblyName == "Assembly-CSharp.dll") {
+				t.Errorf("Format %v: Invalid referenced type names %+v", format, ref)
+			}
+		}
+
+		rewritten := &bytes.Buffer{}
+		if _, err = written.WriteTo(rewritten); err != nil {
+			t.Errorf("Format %v: %v", format, err)
+		} else if !bytes.Equal(rewritten.Bytes(), buf.Bytes()) {
+			t.Errorf("Format %v: Round trip mismatch. Got %v bytes, expected %v", format, rewritten.Len(), buf.Len())
+		}
+	}
+}
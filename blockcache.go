@@ -0,0 +1,125 @@
+package unity
+
+import (
+	"container/list"
+	"sync"
+)
+
+// BlockCache keeps recently used decompressed blocks of archive storage
+// bundles within a byte budget, evicting the least recently used blocks
+// first. One cache can be shared by several bundles and is safe for
+// concurrent use.
+type BlockCache struct {
+	budget  int64
+	size    int64
+	entries map[blockKey]*list.Element
+	lru     *list.List // Most recently used at the front
+
+	hits      int64
+	misses    int64
+	evictions int64
+	mu        sync.Mutex
+}
+
+type BlockCacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Blocks    int
+	Size      int64 // Bytes of cached block data
+	Budget    int64
+}
+
+type blockKey struct {
+	storage *ArchiveBlockStorage
+	index   int
+}
+
+type blockEntry struct {
+	key  blockKey
+	data []byte
+}
+
+// Creates a cache holding at most budget bytes of decompressed blocks.
+func NewBlockCache(budget int64) *BlockCache {
+	return &BlockCache{
+		budget:  budget,
+		entries: make(map[blockKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Returns the cached data of a block and marks it as recently used.
+func (c *BlockCache) get(storage *ArchiveBlockStorage, index int) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, found := c.entries[blockKey{storage, index}]; found {
+		c.hits++
+		c.lru.MoveToFront(elem)
+		return elem.Value.(*blockEntry).data, true
+	}
+
+	c.misses++
+	return nil, false
+}
+
+// Adds the data of a block, evicting older blocks to stay within the
+// budget. Blocks larger than the budget are not cached.
+func (c *BlockCache) add(storage *ArchiveBlockStorage, index int, data []byte) {
+	size := int64(len(data))
+	if size > c.budget {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := blockKey{storage, index}
+	if elem, found := c.entries[key]; found {
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	for c.size+size > c.budget {
+		c.evict(c.lru.Back())
+		c.evictions++
+	}
+
+	c.entries[key] = c.lru.PushFront(&blockEntry{key, data})
+	c.size += size
+}
+
+func (c *BlockCache) evict(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*blockEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.data))
+}
+
+// Drops the cached blocks of storage.
+func (c *BlockCache) remove(storage *ArchiveBlockStorage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*blockEntry).key.storage == storage {
+			c.evict(elem)
+		}
+		elem = next
+	}
+}
+
+func (c *BlockCache) Stats() BlockCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return BlockCacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Blocks:    c.lru.Len(),
+		Size:      c.size,
+		Budget:    c.budget,
+	}
+}
@@ -0,0 +1,107 @@
+package unity
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBlockCache(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	storage := makeBlockStorage(t, data, 128)
+	cache := NewBlockCache(3 * 128)
+	storage.Cache = cache
+	storage.Workers = 1
+
+	// Every block is read once, keeping the last three
+	p := make([]byte, len(data))
+	if _, err := storage.ReadAt(p, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, data) {
+		t.Error("Data mismatch")
+	}
+
+	stats := cache.Stats()
+	expected := BlockCacheStats{Misses: 8, Evictions: 5, Blocks: 3, Size: 128*2 + 1000 - 7*128, Budget: 3 * 128}
+	if stats != expected {
+		t.Errorf("Invalid stats. Got: %+v Expected: %+v", stats, expected)
+	}
+
+	// Blocks 5 and 6 are cached, block 0 was evicted
+	for _, off := range []int64{5 * 128, 6 * 128, 0} {
+		p := make([]byte, 10)
+		if _, err := storage.ReadAt(p, off); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(p, data[off:off+10]) {
+			t.Errorf("ReadAt(%v): Data mismatch", off)
+		}
+	}
+
+	stats = cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 9 || stats.Size > stats.Budget {
+		t.Errorf("Invalid stats after random access: %+v", stats)
+	}
+
+	// Blocks larger than the budget are not cached
+	small := NewBlockCache(64)
+	storage = makeBlockStorage(t, data, 128)
+	storage.Cache = small
+	if _, err := storage.ReadAt(p, 0); err != nil {
+		t.Fatal(err)
+	}
+	if stats = small.Stats(); stats.Blocks != 0 || stats.Size != 0 {
+		t.Errorf("Invalid stats for oversized blocks: %+v", stats)
+	}
+}
+
+func TestBundleBlockCache(t *testing.T) {
+	serialized := readTestSerializedFile(t, "test/main_dxt1_bc1.unity3d")
+	buf := &bytes.Buffer{}
+	nodes := []BundleNode{{Name: "CAB-test", Status: NodeStatusSerializedFile, Size: int64(len(serialized)), Data: bytes.NewReader(serialized)}}
+	if err := WriteBundle(buf, nodes, &WriteOptions{Compression: CompressionLZ4}); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewBlockCache(8 * ChunkSizeLZ4)
+	bundle, err := OpenBundle(bytes.NewReader(buf.Bytes()), int64(buf.Len()), &Options{BlockCache: cache})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bundle.ResolveAsset(0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The small objects are read twice more after all objects were read,
+	// the last time from the cache
+	asset := bundle.Assets[0]
+	for i := 0; i < 3; i++ {
+		for _, pathID := range asset.PathIDs {
+			obj := asset.Objects[pathID]
+			if i > 0 && obj.Size > 2*ChunkSizeLZ4 {
+				continue
+			}
+			data, err := asset.ObjectData(pathID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := asset.DataOffset + obj.DataOffset
+			if !bytes.Equal(data, serialized[start:start+int64(obj.Size)]) {
+				t.Errorf("Object %v data mismatch", pathID)
+			}
+		}
+	}
+
+	stats := cache.Stats()
+	if stats.Hits == 0 || stats.Misses < int64(len(bundle.Blocks)) || stats.Size > stats.Budget {
+		t.Errorf("Invalid stats: %+v", stats)
+	}
+
+	bundle.Close()
+	if stats = cache.Stats(); stats.Blocks != 0 || stats.Size != 0 {
+		t.Errorf("Blocks left in the cache after Close: %+v", stats)
+	}
+}
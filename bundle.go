@@ -3,9 +3,7 @@ package unity
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
-
-	"github.com/cloudflare/golz4"
+	"io"
 )
 
 const (
@@ -15,6 +13,15 @@ const (
 	SignatureArchive = "UnityArchive"
 )
 
+// Archive storage (UnityFS) header flags
+const (
+	ArchiveCompressionMask             = 0x3F
+	ArchiveBlocksAndDirectoryCombined  = 0x40
+	ArchiveBlocksInfoAtEnd             = 0x80
+	ArchiveOldWebPluginCompatibility   = 0x100
+	ArchiveBlockInfoNeedPaddingAtStart = 0x200
+)
+
 const (
 	CompressionNone = iota
 	CompressionLZMA
@@ -25,6 +32,7 @@ const (
 )
 
 type Bundle struct {
+	Path             string // Location on disk, if opened from a file
 	Signature        string
 	FormatVersion    int32
 	TargetVersion    string
@@ -49,164 +57,643 @@ type Bundle struct {
 	Flags           uint32
 	CompressionType int
 	Name            string
+	Blocks          []ArchiveBlockInfo
+	Nodes           []ArchiveNode
 	Assets          []*Asset
+
+	source  io.ReaderAt
+	size    int64
+	storage io.ReaderAt // Uncompressed data the nodes refer to
+	closer  io.Closer
+	options Options
+}
+
+// Options configure how a bundle is opened. A nil *Options uses the defaults.
+type Options struct {
+	Limits Limits
+
+	// Keeps decompressed blocks of archive storage bundles for random
+	// access. Without a cache only the last used block is kept.
+	BlockCache *BlockCache
+
+	// Goroutines decompressing the blocks of reads that span several
+	// blocks and of Preload; runtime.NumCPU() if 0.
+	Workers int
+
+	// Type trees for files without them, DefaultTypeDatabase if nil
+	TypeDatabase *TypeDatabase
 }
 
+// Size of the file prefix read to parse a bundle header
+const headerProbeSize = 4096
+
+// Reads the bundle at path into memory, mapping it where supported until
+// Close. Bundles split into .splitN parts are
+// joined in place instead and keep their files open until Close.
 func ReadBundle(path string) (*Bundle, error) {
-	buf, err := ioutil.ReadFile(path)
+	if isSplitFile(path) {
+		return OpenBundleFile(path, nil)
+	}
+
+	reader, err := NewMappedReader(path)
 	if err != nil {
 		return nil, err
 	}
 
-	reader, err := NewReader(buf)
+	bundle, err := OpenBundle(reader, reader.Len(), nil)
+	if err != nil {
+		reader.Close()
+		return nil, setErrorLocation(err, path, "")
+	}
+	bundle.Path = path
+	bundle.closer = reader
+
+	return bundle, nil
+}
+
+// Opens the bundle at path, keeping the file open until Close. Split
+// bundles are joined from their .splitN parts.
+func OpenBundleFile(path string, opts *Options) (*Bundle, error) {
+	r, size, err := openFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	bundle := &Bundle{}
-	if bundle.Signature, err = reader.StringNull(); err != nil {
+	bundle, err := OpenBundle(r, size, opts)
+	if err != nil {
+		r.Close()
+		return nil, setErrorLocation(err, path, "")
+	}
+	bundle.Path = path
+	bundle.closer = r
+
+	return bundle, nil
+}
+
+type readerAtCloser interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// Opens the file at path, or the joined parts of a split file.
+func openFile(path string) (readerAtCloser, int64, error) {
+	if isSplitFile(path) {
+		m, err := OpenSplitFile(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		return m, m.Size(), nil
+	}
+
+	return openFileMapped(path)
+}
+
+// Opens a bundle of size bytes from r. Only the header and the directory are
+// read here; data blocks are read and decompressed when an asset is loaded.
+// The bundle doesn't take ownership of r, which the caller closes after
+// Close.
+func OpenBundle(r io.ReaderAt, size int64, opts *Options) (*Bundle, error) {
+	bundle := &Bundle{
+		source: r,
+		size:   size,
+	}
+	if opts != nil {
+		bundle.options = *opts
+	}
+	limits := bundle.options.Limits.withDefaults()
+	bundle.options.Limits = limits
+
+	header, err := bundle.readAt(0, headerProbeSize)
+	if err != nil {
+		return nil, formatError(StageHeader, 0, err)
+	}
+
+	// Gzip and brotli wrapped files are decompressed into memory
+	if unwrapped, err := decompressWrapped(r, size, header, limits); err != nil {
+		return nil, formatError(StageHeader, 0, err)
+	} else if unwrapped != nil {
+		return OpenBundle(unwrapped, unwrapped.Len(), opts)
+	}
+
+	reader, err := NewReader(header)
+	if err != nil {
 		return nil, err
 	}
+
+	if bundle.Signature, err = reader.StringNull(); err != nil {
+		return nil, formatError(StageHeader, reader.Tell(), err)
+	}
+	if bundle.Signature == SignatureWebData {
+		if err = readWebData(bundle, reader); err != nil {
+			return nil, err
+		}
+		return bundle, nil
+	}
 	if bundle.FormatVersion, err = reader.Int32(); err != nil {
-		return nil, err
+		return nil, formatError(StageHeader, reader.Tell(), err)
 	}
 	if bundle.TargetVersion, err = reader.StringNull(); err != nil {
-		return nil, err
+		return nil, formatError(StageHeader, reader.Tell(), err)
 	}
 	if bundle.GeneratorVersion, err = reader.StringNull(); err != nil {
-		return nil, err
+		return nil, formatError(StageHeader, reader.Tell(), err)
 	}
 
 	switch bundle.Signature {
-	case SignatureRaw:
-	case SignatureWeb:
-		return bundle, readRaw(bundle, reader)
+	case SignatureRaw, SignatureWeb:
+		err = readRaw(bundle, reader)
 	case SignatureFS:
-		return bundle, readFS(bundle, reader)
+		err = readFS(bundle, reader)
 	case SignatureArchive:
-		return bundle, readArchive(bundle, reader)
+		err = readArchive(bundle, reader)
+	default:
+		err = formatError(StageHeader, 0, fmt.Errorf("Unsupported signature: %s", bundle.Signature))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+// Reads at most n bytes at off from the bundle source.
+func (bundle *Bundle) readAt(off int64, n int64) ([]byte, error) {
+	if off < 0 || off > bundle.size || n < 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if off+n > bundle.size {
+		n = bundle.size - off
+	}
+	if err := bundle.options.Limits.checkAllocation("read", n); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, n)
+	if read, err := bundle.source.ReadAt(b, off); int64(read) < n {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// Returns the bundle data at off, slicing it if the source is in memory.
+func (bundle *Bundle) sourceSection(off, n int64) io.ReaderAt {
+	if source, ok := bundle.source.(memorySource); ok {
+		if data, err := source.slice(off, n); err == nil {
+			reader, _ := NewReader(data)
+			return reader
+		}
+	}
+	return io.NewSectionReader(bundle.source, off, n)
+}
+
+// Releases the bundle data and closes the file opened by ReadBundle or
+// OpenBundleFile. Assets that were not loaded can't be loaded afterwards.
+func (bundle *Bundle) Close() error {
+	var err error
+	if bundle.closer != nil {
+		err = bundle.closer.Close()
+		bundle.closer = nil
+	}
+
+	if storage, ok := bundle.storage.(*ArchiveBlockStorage); ok && storage.Cache != nil {
+		storage.Cache.remove(storage)
+	}
+
+	bundle.source = nil
+	bundle.storage = nil
+	for _, asset := range bundle.Assets {
+		asset.source = nil
+	}
+
+	return err
+}
+
+// Returns the data of the bundle node at index.
+func (bundle *Bundle) OpenNode(index int) (*io.SectionReader, error) {
+	if bundle.storage == nil {
+		return nil, errors.New("unity.Bundle.OpenNode: Bundle is closed")
+	}
+	if index < 0 || index >= len(bundle.Nodes) {
+		return nil, fmt.Errorf("unity.Bundle.OpenNode: Invalid node index %v", index)
+	}
+	node := bundle.Nodes[index]
+	return io.NewSectionReader(bundle.storage, node.Offset, node.Size), nil
+}
+
+// Opens a bundle stored in the node at index, such as the data.unity3d of a
+// WebGL build.
+func (bundle *Bundle) OpenNestedBundle(index int, opts *Options) (*Bundle, error) {
+	section, err := bundle.OpenNode(index)
+	if err != nil {
+		return nil, err
+	}
+	return OpenBundle(section, section.Size(), opts)
+}
+
+// Validates the node directory against the size of the bundle data and
+// creates an asset for every node.
+func (bundle *Bundle) addNodeAssets(dataSize int64) error {
+	for i, node := range bundle.Nodes {
+		if node.Offset < 0 || node.Size < 0 || node.Offset+node.Size > dataSize {
+			return &FormatError{
+				Node:   node.Name,
+				Offset: node.Offset,
+				Stage:  StageDirectory,
+				Err:    fmt.Errorf("Node out of bounds (%v+%v > %v)", node.Offset, node.Size, dataSize),
+			}
+		}
+
+		// WebGL containers also hold bundles, scripts and other files
+		if bundle.Signature == SignatureWebData && !bundle.isAssetNode(i) {
+			continue
+		}
+
+		var section io.ReaderAt
+		if storage, ok := bundle.storage.(memorySource); ok {
+			data, err := storage.slice(node.Offset, node.Size)
+			if err != nil {
+				return &FormatError{Node: node.Name, Offset: node.Offset, Stage: StageDirectory, Err: err}
+			}
+			section, _ = NewReader(data)
+		} else {
+			nodeSection, err := bundle.OpenNode(i)
+			if err != nil {
+				return &FormatError{Node: node.Name, Offset: node.Offset, Stage: StageDirectory, Err: err}
+			}
+			section = nodeSection
+		}
+		asset := newAsset(bundle)
+		asset.Name = node.Name
+		asset.source = section
+		asset.size = node.Size
+		bundle.Assets = append(bundle.Assets, asset)
 	}
 
-	return nil, fmt.Errorf("Unsupported signature: %s", bundle.Signature)
+	if len(bundle.Nodes) > 0 {
+		bundle.Name = bundle.Nodes[0].Name
+	}
+
+	return nil
+}
+
+// Decompresses all blocks of an archive storage bundle into memory with
+// Options.Workers goroutines, so that assets are then read from memory.
+func (bundle *Bundle) Preload() error {
+	storage, ok := bundle.storage.(*ArchiveBlockStorage)
+	if !ok {
+		return nil
+	}
+
+	if err := bundle.options.Limits.checkAllocation("bundle data", storage.VirtualSize); err != nil {
+		return err
+	}
+	return storage.DecompressAll()
 }
 
 func (bundle *Bundle) ResolveAsset(index int) error {
+	if index < 0 || index >= len(bundle.Assets) {
+		return fmt.Errorf("unity.Bundle.ResolveAsset: Invalid asset index %v", index)
+	}
 	return bundle.Assets[index].LoadObjects(bundle.Signature)
 }
 
+func (bundle *Bundle) IsArchiveStorage() bool {
+	return bundle.Signature == SignatureFS || bundle.Signature == SignatureArchive
+}
+
 func (bundle *Bundle) Compressed() bool {
 	return bundle.Signature == SignatureWeb
 }
 
+// Decompresses the block info and directory of an archive storage bundle.
 func (bundle *Bundle) Decompress(reader *Reader, compressionType int) ([]byte, error) {
-	data, _ := reader.Bytes(int64(bundle.CIBlockSize))
-	switch compressionType {
-	case CompressionNone:
-		return data, nil
-	case CompressionLZ4:
-	case CompressionLZ4HC:
-		decompressed := make([]byte, int(bundle.UIBlockSize))
-		return decompressed, lz4.Uncompress(data, decompressed)
+	data, err := reader.Bytes(int64(bundle.CIBlockSize))
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("unity.Bundle.Decompress: Unsupported compression type: %v", compressionType)
+	block := ArchiveBlockInfo{
+		UncompressedSize: int32(bundle.UIBlockSize),
+		CompressedSize:   int32(bundle.CIBlockSize),
+		Flags:            int16(compressionType),
+	}
+	return block.decompress(data, bundle.options.Limits)
 }
 
+// UnityWeb and UnityRaw share one layout. The header lists the size of each
+// streamed level; every level holds all the data of the levels before it, so
+// only the last one needs to be read. For UnityWeb it is an LZMA stream. The
+// level data starts with the directory of the files it contains.
 func readRaw(bundle *Bundle, reader *Reader) (err error) {
-	bundle.FileSize, _ = reader.Uint32()
-	bundle.HeaderSize, _ = reader.Uint32()
-	bundle.FileCount, _ = reader.Uint32()
-	bundle.BundleCount, _ = reader.Uint32()
+	if bundle.FormatVersion >= 4 {
+		// Hash and CRC
+		if _, err = reader.Bytes(20); err != nil {
+			return formatError(StageHeader, reader.Tell(), err)
+		}
+	}
+
+	if bundle.FileSize, err = reader.Uint32(); err != nil {
+		return formatError(StageHeader, reader.Tell(), err)
+	}
+	if bundle.HeaderSize, err = reader.Uint32(); err != nil {
+		return formatError(StageHeader, reader.Tell(), err)
+	}
+	if bundle.FileCount, err = reader.Uint32(); err != nil {
+		return formatError(StageHeader, reader.Tell(), err)
+	}
+	if bundle.BundleCount, err = reader.Uint32(); err != nil {
+		return formatError(StageHeader, reader.Tell(), err)
+	}
+
+	if int64(bundle.HeaderSize) > reader.Len() {
+		header, err := bundle.readAt(0, int64(bundle.HeaderSize))
+		if err != nil {
+			return formatError(StageHeader, 0, err)
+		}
+		offset := reader.Tell()
+		if reader, err = NewReader(header); err != nil {
+			return err
+		}
+		if _, err = reader.SeekStart(offset); err != nil {
+			return formatError(StageHeader, reader.Tell(), err)
+		}
+	}
+
+	limits := bundle.options.Limits
+	if err = limits.checkCount("level", int64(bundle.BundleCount)); err != nil {
+		return formatError(StageHeader, reader.Tell(), err)
+	}
+
+	compression := int16(CompressionNone)
+	if bundle.Compressed() {
+		compression = CompressionLZMA
+	}
+
+	for i := uint32(0); i < bundle.BundleCount; i++ {
+		block := ArchiveBlockInfo{Flags: compression}
+		if block.CompressedSize, err = reader.Int32(); err != nil {
+			return formatError(StageHeader, reader.Tell(), err)
+		}
+		if block.UncompressedSize, err = reader.Int32(); err != nil {
+			return formatError(StageHeader, reader.Tell(), err)
+		}
+		bundle.Blocks = append(bundle.Blocks, block)
+	}
 
 	if bundle.FormatVersion >= 2 {
-		bundle.BundleSize, _ = reader.Uint32()
+		if bundle.CompressedFileSize, err = reader.Uint32(); err != nil {
+			return formatError(StageHeader, reader.Tell(), err)
+		}
 		if bundle.FormatVersion >= 3 {
-			bundle.UncompressedBundleSize, _ = reader.Uint32()
+			if bundle.AssetHeaderSize, err = reader.Uint32(); err != nil {
+				return formatError(StageHeader, reader.Tell(), err)
+			}
 		}
 	}
 
-	if bundle.HeaderSize >= 60 {
-		bundle.CompressedFileSize, _ = reader.Uint32()
-		bundle.AssetHeaderSize, _ = reader.Uint32()
+	if len(bundle.Blocks) == 0 {
+		return nil
 	}
 
-	_, _ = reader.Int32()
-	_, _ = reader.Int8()
+	last := bundle.Blocks[len(bundle.Blocks)-1]
+	bundle.BundleSize = uint32(last.CompressedSize)
+	bundle.UncompressedBundleSize = uint32(last.UncompressedSize)
+	if err = limits.checkAllocation("level", int64(last.CompressedSize)); err == nil {
+		err = limits.checkDecompressed(int64(last.UncompressedSize))
+	}
+	if err != nil {
+		return formatError(StageHeader, reader.Tell(), err)
+	}
 
-	bundle.Name, _ = reader.StringNull()
+	var directory []byte
+	if bundle.Compressed() {
+		data, err := bundle.readAt(int64(bundle.HeaderSize), int64(last.CompressedSize))
+		if err != nil {
+			return formatError(StageBlock, int64(bundle.HeaderSize), err)
+		}
+		if directory, err = decompressLZMA(data, limits); err != nil {
+			return formatError(StageBlock, int64(bundle.HeaderSize), err)
+		}
+		bundle.storage, _ = NewReader(directory)
+	} else {
+		bundle.storage = bundle.sourceSection(int64(bundle.HeaderSize), int64(last.UncompressedSize))
+		dirSize := int64(last.UncompressedSize)
+		if bundle.AssetHeaderSize > 0 && int64(bundle.AssetHeaderSize) < dirSize {
+			dirSize = int64(bundle.AssetHeaderSize)
+		}
+		if directory, err = bundle.readAt(int64(bundle.HeaderSize), dirSize); err != nil {
+			return formatError(StageDirectory, int64(bundle.HeaderSize), err)
+		}
+	}
 
-	reader.SeekStart(int64(bundle.HeaderSize))
+	levelReader, err := NewReader(directory)
+	if err != nil {
+		return err
+	}
 
-	numAssets := uint32(1)
-	if bundle.Compressed() {
-		numAssets, _ = reader.Uint32()
+	numNodes, err := levelReader.Int32()
+	if err == nil {
+		err = limits.checkCount("node", int64(numNodes))
+	}
+	if err != nil {
+		return formatError(StageDirectory, levelReader.Tell(), err)
 	}
 
-	for i := uint32(0); i < numAssets; i++ {
-		bundle.Assets = append(bundle.Assets, AssetFromBundle(bundle, reader))
+	for i := int32(0); i < numNodes; i++ {
+		node := ArchiveNode{}
+		if node.Name, err = levelReader.StringNull(); err != nil {
+			return formatError(StageDirectory, levelReader.Tell(), err)
+		}
+		offset, err := levelReader.Uint32()
+		if err != nil {
+			return formatError(StageDirectory, levelReader.Tell(), err)
+		}
+		size, err := levelReader.Uint32()
+		if err != nil {
+			return formatError(StageDirectory, levelReader.Tell(), err)
+		}
+		node.Offset = int64(offset)
+		node.Size = int64(size)
+		bundle.Nodes = append(bundle.Nodes, node)
 	}
 
-	return nil
+	return bundle.addNodeAssets(int64(last.UncompressedSize))
 }
 
 func readFS(bundle *Bundle, reader *Reader) (err error) {
-	bundle.FSFileSize, _ = reader.Int64()
-	bundle.CIBlockSize, _ = reader.Uint32()
-	bundle.UIBlockSize, _ = reader.Uint32()
+	if err = readArchiveHeader(bundle, reader); err != nil {
+		return err
+	}
+
+	// Since 2020.3.34, 2021.3.2 and 2022.1.1 the header is padded.
+	if bundle.FormatVersion >= 7 {
+		if _, err = reader.AlignTo(16); err != nil {
+			return formatError(StageHeader, reader.Tell(), err)
+		}
+	}
+
+	return readArchiveStorage(bundle, reader)
+}
 
-	flags, _ := reader.Uint32()
-	compressionType := int(flags & 0x3F)
-	eofMetadata := (flags & 0x80) > 0
-	if eofMetadata {
-		fmt.Println("eof")
+// UnityArchive is the archive storage signature of older editor-built
+// archives, which UnityFS replaced. Its header has the fields of UnityFS
+// format 6 and earlier, without padding, and is followed by the same block
+// info and data blocks. The layout is the archive storage layout readFS
+// reads; TestReadArchive cross-checks it on a UnityFS format 6 sample read
+// under this signature.
+func readArchive(bundle *Bundle, reader *Reader) (err error) {
+	if bundle.FormatVersion >= 7 {
+		return formatError(StageHeader, reader.Tell(), fmt.Errorf("Unsupported UnityArchive version %v", bundle.FormatVersion))
+	}
+	if err = readArchiveHeader(bundle, reader); err != nil {
+		return err
+	}
+	return readArchiveStorage(bundle, reader)
+}
+
+// Reads the archive storage header fields that follow the Unity versions.
+func readArchiveHeader(bundle *Bundle, reader *Reader) (err error) {
+	if bundle.FSFileSize, err = reader.Int64(); err != nil {
+		return formatError(StageHeader, reader.Tell(), err)
+	}
+	if bundle.CIBlockSize, err = reader.Uint32(); err != nil {
+		return formatError(StageHeader, reader.Tell(), err)
+	}
+	if bundle.UIBlockSize, err = reader.Uint32(); err != nil {
+		return formatError(StageHeader, reader.Tell(), err)
+	}
+	if bundle.Flags, err = reader.Uint32(); err != nil {
+		return formatError(StageHeader, reader.Tell(), err)
+	}
+	bundle.CompressionType = int(bundle.Flags & ArchiveCompressionMask)
+	return nil
+}
+
+// Reads the block info at its place after the header at the reader position
+// or at the end of the file, and the node directory.
+func readArchiveStorage(bundle *Bundle, reader *Reader) (err error) {
+	infoOffset := reader.Tell()
+	dataOffset := infoOffset + int64(bundle.CIBlockSize)
+	if bundle.Flags&ArchiveBlocksInfoAtEnd > 0 {
+		infoOffset = bundle.size - int64(bundle.CIBlockSize)
+		dataOffset = reader.Tell()
+	}
+
+	if bundle.Flags&ArchiveBlockInfoNeedPaddingAtStart > 0 {
+		dataOffset = (dataOffset + 15) & -16
+	}
+
+	limits := bundle.options.Limits
+	if err = limits.checkAllocation("block info", int64(bundle.CIBlockSize)); err == nil {
+		err = limits.checkAllocation("block info", int64(bundle.UIBlockSize))
+	}
+	if err != nil {
+		return formatError(StageHeader, reader.Tell(), err)
+	}
+
+	info, err := bundle.readAt(infoOffset, int64(bundle.CIBlockSize))
+	if err != nil {
+		return formatError(StageBlockInfo, infoOffset, err)
+	}
+	infoReader, err := NewReader(info)
+	if err != nil {
+		return err
+	}
+
+	bundleData, err := bundle.Decompress(infoReader, bundle.CompressionType)
+	if err != nil {
+		return formatError(StageBlockInfo, infoOffset, err)
 	}
 
-	bundleData, err := bundle.Decompress(reader, compressionType)
 	bundleReader, err := NewReader(bundleData)
 	if err != nil {
 		return err
 	}
 
-	_, _ = bundleReader.Bytes(16)
+	// Offsets of errors are within the uncompressed block info
+	fail := func(err error) error {
+		return formatError(StageBlockInfo, bundleReader.Tell(), err)
+	}
+
+	if _, err = bundleReader.Bytes(16); err != nil {
+		return fail(err)
+	}
 
-	numBlocks, _ := bundleReader.Int32()
+	numBlocks, err := bundleReader.Int32()
+	if err == nil {
+		err = limits.checkCount("block", int64(numBlocks))
+	}
+	if err != nil {
+		return fail(err)
+	}
 	blocks := []ArchiveBlockInfo{}
+	virtualSize := int64(0)
 	for i := 0; i < int(numBlocks); i++ {
-		buSize, _ := bundleReader.Int32()
-		bcSize, _ := bundleReader.Int32()
-		flags, _ := bundleReader.Int16()
-		blocks = append(blocks, ArchiveBlockInfo{buSize, bcSize, flags})
+		block := ArchiveBlockInfo{}
+		if block.UncompressedSize, err = bundleReader.Int32(); err != nil {
+			return fail(err)
+		}
+		if block.CompressedSize, err = bundleReader.Int32(); err != nil {
+			return fail(err)
+		}
+		if block.Flags, err = bundleReader.Int16(); err != nil {
+			return fail(err)
+		}
+		if err = limits.checkAllocation("block", int64(block.CompressedSize)); err != nil {
+			return fail(err)
+		}
+		if err = limits.checkAllocation("block", int64(block.UncompressedSize)); err != nil {
+			return fail(err)
+		}
+		virtualSize += int64(block.UncompressedSize)
+		if err = limits.checkDecompressed(virtualSize); err != nil {
+			return fail(err)
+		}
+		blocks = append(blocks, block)
 	}
 
-	numNodes, _ := bundleReader.Int32()
+	numNodes, err := bundleReader.Int32()
+	if err == nil {
+		err = limits.checkCount("node", int64(numNodes))
+	}
+	if err != nil {
+		return fail(err)
+	}
 	nodes := []ArchiveNode{}
 	for i := 0; i < int(numNodes); i++ {
-		offset, _ := bundleReader.Int64()
-		size, _ := bundleReader.Int64()
-		status, _ := bundleReader.Int32()
-		name, _ := bundleReader.StringNull()
-		nodes = append(nodes, ArchiveNode{offset, size, status, name})
-	}
-
-	for i, node := range nodes {
-		reader.SeekCurrent(node.Offset)
-		block := blocks[i]
-		compressed, _ := reader.Bytes(int64(block.CompressedSize))
-		decompressed, err := block.Decompress(compressed)
-		if err != nil {
-			panic(err)
+		node := ArchiveNode{}
+		if node.Offset, err = bundleReader.Int64(); err != nil {
+			return fail(err)
 		}
-		currentBlock, _ := NewReader(decompressed)
-		asset := AssetFromBundle(bundle, currentBlock)
-		asset.Name = node.Name
-		bundle.Assets = append(bundle.Assets, asset)
+		if node.Size, err = bundleReader.Int64(); err != nil {
+			return fail(err)
+		}
+		if node.Status, err = bundleReader.Int32(); err != nil {
+			return fail(err)
+		}
+		if node.Name, err = bundleReader.StringNull(); err != nil {
+			return fail(err)
+		}
+		nodes = append(nodes, node)
 	}
 
-	bundle.Name = nodes[0].Name
+	bundle.Blocks = blocks
+	bundle.Nodes = nodes
 
-	return nil
-}
+	storage := NewArchiveBlockStorage(bundle.source, dataOffset, blocks)
+	storage.Cache = bundle.options.BlockCache
+	storage.Workers = bundle.options.Workers
+	storage.Limits = bundle.options.Limits
+	bundle.storage = storage
 
-func readArchive(bundle *Bundle, reader *Reader) (err error) {
-	return errors.New("UnityArchive currently not supported.")
+	// Uncompressed blocks of a bundle in memory are used in place
+	if storage.uncompressed() {
+		bundle.storage = bundle.sourceSection(dataOffset, storage.VirtualSize)
+	}
+
+	return bundle.addNodeAssets(storage.VirtualSize)
 }
@@ -1,9 +1,20 @@
 package unity
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
 	"testing"
+
+	"github.com/itchio/lzma"
 )
 
 func TestReadBundle(t *testing.T) {
@@ -38,3 +49,483 @@ func TestReadBundle(t *testing.T) {
 		}
 	}
 }
+
+// Packs files into a UnityArchive bundle with uncompressed blocks of at most
+// blockSize bytes, following the archive storage header field by field.
+func makeArchiveBundle(names []string, files [][]byte, blockSize int, flags uint32) []byte {
+	be := binary.BigEndian
+	var data []byte
+	for _, file := range files {
+		data = append(data, file...)
+	}
+
+	info := &bytes.Buffer{}
+	info.Write(make([]byte, 16)) // Uncompressed data hash
+	numBlocks := (len(data) + blockSize - 1) / blockSize
+	binary.Write(info, be, int32(numBlocks))
+	for i := 0; i < numBlocks; i++ {
+		size := blockSize
+		if rest := len(data) - i*blockSize; rest < size {
+			size = rest
+		}
+		binary.Write(info, be, int32(size))
+		binary.Write(info, be, int32(size))
+		binary.Write(info, be, int16(CompressionNone))
+	}
+	binary.Write(info, be, int32(len(files)))
+	offset := int64(0)
+	for i, file := range files {
+		binary.Write(info, be, offset)
+		binary.Write(info, be, int64(len(file)))
+		if filepath.Ext(names[i]) == "" {
+			binary.Write(info, be, int32(4)) // Serialized file
+		} else {
+			binary.Write(info, be, int32(0))
+		}
+		info.WriteString(names[i] + "\x00")
+		offset += int64(len(file))
+	}
+
+	header := &bytes.Buffer{}
+	header.WriteString(SignatureArchive + "\x00")
+	binary.Write(header, be, int32(6))
+	header.WriteString("5.x.x\x00")
+	header.WriteString("5.3.8p2\x00")
+	binary.Write(header, be, int64(header.Len()+8+4*3+info.Len()+len(data)))
+	binary.Write(header, be, uint32(info.Len()))
+	binary.Write(header, be, uint32(info.Len()))
+	binary.Write(header, be, flags|CompressionNone)
+
+	if flags&ArchiveBlocksInfoAtEnd > 0 {
+		return append(append(header.Bytes(), data...), info.Bytes()...)
+	}
+	return append(append(header.Bytes(), info.Bytes()...), data...)
+}
+
+func TestReadArchive(t *testing.T) {
+	cabData := readTestSerializedFile(t, "test/20147_cs_h")
+	names := []string{"CAB-archive", "CAB-archive.resS"}
+	files := [][]byte{cabData, []byte("streamed data")}
+
+	for _, flags := range []uint32{0, ArchiveBlocksInfoAtEnd} {
+		buf := makeArchiveBundle(names, files, 0x1000, flags)
+		bundle, err := OpenBundle(bytes.NewReader(buf), int64(len(buf)), nil)
+		if err != nil {
+			t.Fatalf("Flags %#x: %v", flags, err)
+		}
+
+		if bundle.Signature != SignatureArchive || bundle.FormatVersion != 6 || bundle.GeneratorVersion != "5.3.8p2" {
+			t.Errorf("Flags %#x: Invalid header: %s %v %s", flags, bundle.Signature, bundle.FormatVersion, bundle.GeneratorVersion)
+		}
+		if bundle.FSFileSize != int64(len(buf)) {
+			t.Errorf("Flags %#x: Invalid file size. Got: %v Expected: %v", flags, bundle.FSFileSize, len(buf))
+		}
+		if len(bundle.Blocks) != (len(cabData)+len(files[1])+0xfff)/0x1000 {
+			t.Errorf("Flags %#x: Invalid block count. Got: %v", flags, len(bundle.Blocks))
+		}
+		if len(bundle.Nodes) != 2 || len(bundle.Assets) != 2 {
+			t.Fatalf("Flags %#x: Got %v nodes and %v assets", flags, len(bundle.Nodes), len(bundle.Assets))
+		}
+
+		if err = bundle.ResolveAsset(0); err != nil {
+			t.Fatalf("Flags %#x: %v", flags, err)
+		}
+		if name := bundle.Assets[0].Name; name != names[0] {
+			t.Errorf("Flags %#x: Invalid asset name. Got: %s", flags, name)
+		}
+		if len(bundle.Assets[0].Objects) != 2 {
+			t.Errorf("Flags %#x: Invalid object count. Got: %v Expected: 2", flags, len(bundle.Assets[0].Objects))
+		}
+
+		node, err := bundle.OpenNode(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err := ioutil.ReadAll(node); err != nil || !bytes.Equal(data, files[1]) {
+			t.Errorf("Flags %#x: Invalid node data: %q (%v)", flags, data, err)
+		}
+	}
+
+	// A real UnityFS format 6 file read as UnityArchive gives the same
+	// header, blocks, nodes and objects
+	fsData, err := ioutil.ReadFile("test/20147_cs_h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := OpenBundle(bytes.NewReader(fsData), int64(len(fsData)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archiveData := append([]byte(SignatureArchive+"\x00"), fsData[len(SignatureFS)+1:]...)
+	archive, err := OpenBundle(bytes.NewReader(archiveData), int64(len(archiveData)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.FormatVersion != 6 || archive.FormatVersion != fs.FormatVersion || archive.Flags != fs.Flags || archive.FSFileSize != fs.FSFileSize {
+		t.Errorf("Header mismatch. Got: %v %#x %v Expected: %v %#x %v", archive.FormatVersion, archive.Flags, archive.FSFileSize, fs.FormatVersion, fs.Flags, fs.FSFileSize)
+	}
+	if !reflect.DeepEqual(archive.Blocks, fs.Blocks) || !reflect.DeepEqual(archive.Nodes, fs.Nodes) {
+		t.Error("Block or node mismatch")
+	}
+	if err = fs.ResolveAsset(0); err == nil {
+		err = archive.ResolveAsset(0)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pathID := range fs.Assets[0].PathIDs {
+		expected, _ := fs.Assets[0].ObjectData(pathID)
+		if got, err := archive.Assets[0].ObjectData(pathID); err != nil || !bytes.Equal(got, expected) {
+			t.Errorf("Object %v data mismatch (%v)", pathID, err)
+		}
+	}
+
+	// The header padding of UnityFS format 7 never applies to UnityArchive
+	buf := makeArchiveBundle(names, files, 0x1000, 0)
+	binary.BigEndian.PutUint32(buf[len(SignatureArchive)+1:], 7)
+	if _, err := OpenBundle(bytes.NewReader(buf), int64(len(buf)), nil); err == nil {
+		t.Error("Expected an error for UnityArchive version 7")
+	}
+}
+
+// Packs files into a single level UnityRaw or UnityWeb bundle.
+func makeRawBundle(t *testing.T, signature string, names []string, files [][]byte) []byte {
+	be := binary.BigEndian
+	level := &bytes.Buffer{}
+	binary.Write(level, be, int32(len(files)))
+	dirSize := 4
+	for _, name := range names {
+		dirSize += len(name) + 1 + 8
+	}
+	offset := uint32(dirSize)
+	for i, name := range names {
+		level.WriteString(name + "\x00")
+		binary.Write(level, be, offset)
+		binary.Write(level, be, uint32(len(files[i])))
+		offset += uint32(len(files[i]))
+	}
+	for _, file := range files {
+		level.Write(file)
+	}
+
+	uncompressedSize := level.Len()
+	if signature == SignatureWeb {
+		compressed := &bytes.Buffer{}
+		w := lzma.NewWriterSize(compressed, int64(level.Len()))
+		if _, err := w.Write(level.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		level = compressed
+	}
+
+	header := &bytes.Buffer{}
+	header.WriteString(signature + "\x00")
+	binary.Write(header, be, int32(3))
+	header.WriteString("3.x.x\x00")
+	header.WriteString("4.7.2f1\x00")
+	headerSize := header.Len() + 4*9
+	binary.Write(header, be, uint32(headerSize+level.Len()))
+	binary.Write(header, be, uint32(headerSize))
+	binary.Write(header, be, uint32(1))
+	binary.Write(header, be, uint32(1))
+	binary.Write(header, be, uint32(level.Len()))
+	binary.Write(header, be, uint32(uncompressedSize))
+	binary.Write(header, be, uint32(headerSize+level.Len()))
+	binary.Write(header, be, uint32(dirSize))
+	binary.Write(header, be, uint32(0))
+
+	return append(header.Bytes(), level.Bytes()...)
+}
+
+func TestReadRawBundle(t *testing.T) {
+	source, err := ReadBundle("test/20147_cs_h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := source.OpenNode(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cabData, err := ioutil.ReadAll(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{source.Nodes[0].Name, source.Nodes[0].Name + ".resource"}
+	files := [][]byte{cabData, []byte("streamed")}
+
+	for _, signature := range []string{SignatureRaw, SignatureWeb} {
+		f, err := ioutil.TempFile("", "unityweb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		f.Write(makeRawBundle(t, signature, names, files))
+		f.Close()
+
+		bundle, err := ReadBundle(f.Name())
+		if err != nil {
+			t.Fatalf("%s: %v", signature, err)
+		}
+
+		if len(bundle.Nodes) != 2 || len(bundle.Assets) != 2 {
+			t.Fatalf("%s: Invalid node count. Got: %v Expected: 2", signature, len(bundle.Nodes))
+		}
+
+		for i, asset := range bundle.Assets {
+			if asset.Name != names[i] {
+				t.Errorf("%s: Invalid asset name. Got: %s Expected: %s", signature, asset.Name, names[i])
+			}
+			if err = bundle.ResolveAsset(i); err != nil {
+				t.Errorf("%s: %v", signature, err)
+			}
+		}
+
+		if len(bundle.Assets[0].Objects) != 2 {
+			t.Errorf("%s: Invalid object count. Got: %v Expected: 2", signature, len(bundle.Assets[0].Objects))
+		}
+	}
+}
+
+// Rebuilds a UnityFS bundle with the given format version and header flags,
+// moving the block info to the end of the file or padding it as requested.
+func relayoutFSBundle(t *testing.T, buf []byte, version int32, extraFlags uint32) []byte {
+	be := binary.BigEndian
+	pos := len(SignatureFS) + 1 + 4
+	for i := 0; i < 2; i++ {
+		pos += bytes.IndexByte(buf[pos:], 0) + 1
+	}
+	versions := buf[len(SignatureFS)+1+4 : pos]
+	ciSize := be.Uint32(buf[pos+8:])
+	flags := be.Uint32(buf[pos+16:]) | extraFlags
+	info := buf[pos+20 : pos+20+int(ciSize)]
+	data := buf[pos+20+int(ciSize):]
+
+	out := &bytes.Buffer{}
+	pad := func() {
+		for out.Len()%16 != 0 {
+			out.WriteByte(0)
+		}
+	}
+
+	out.WriteString(SignatureFS + "\x00")
+	binary.Write(out, be, version)
+	out.Write(versions)
+	out.Write(buf[pos : pos+16])
+	binary.Write(out, be, flags)
+	if version >= 7 {
+		pad()
+	}
+	if flags&ArchiveBlocksInfoAtEnd > 0 {
+		out.Write(data)
+		out.Write(info)
+	} else {
+		out.Write(info)
+		if flags&ArchiveBlockInfoNeedPaddingAtStart > 0 {
+			pad()
+		}
+		out.Write(data)
+	}
+
+	return out.Bytes()
+}
+
+func TestReadFSLayouts(t *testing.T) {
+	buf, err := ioutil.ReadFile("test/main_dxt1_bc1.unity3d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layouts := []struct {
+		version int32
+		flags   uint32
+	}{
+		{6, ArchiveBlocksInfoAtEnd},
+		{7, 0},
+		{7, ArchiveBlockInfoNeedPaddingAtStart},
+		{7, ArchiveBlocksInfoAtEnd},
+	}
+
+	for _, tc := range layouts {
+		f, err := ioutil.TempFile("", "unityfs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		f.Write(relayoutFSBundle(t, buf, tc.version, tc.flags))
+		f.Close()
+
+		bundle, err := ReadBundle(f.Name())
+		if err != nil {
+			t.Errorf("Version %v, flags %#x: %v", tc.version, tc.flags, err)
+			continue
+		}
+
+		if err = bundle.ResolveAsset(0); err != nil {
+			t.Errorf("Version %v, flags %#x: %v", tc.version, tc.flags, err)
+			continue
+		}
+
+		if len(bundle.Assets[0].Objects) != 4 {
+			t.Errorf("Version %v, flags %#x: Invalid object count. Got: %v Expected: 4", tc.version, tc.flags, len(bundle.Assets[0].Objects))
+		}
+	}
+}
+
+type trackingReaderAt struct {
+	*bytes.Reader
+	read   int64
+	closed bool
+}
+
+func (r *trackingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(p, off)
+	r.read += int64(n)
+	return n, err
+}
+
+func (r *trackingReaderAt) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestOpenBundle(t *testing.T) {
+	buf, err := ioutil.ReadFile("test/main_dxt1_bc1.unity3d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := &trackingReaderAt{Reader: bytes.NewReader(buf)}
+	bundle, err := OpenBundle(source, int64(len(buf)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if source.read >= int64(len(buf)) {
+		t.Errorf("Opening read the whole bundle (%v bytes)", source.read)
+	}
+
+	if err = bundle.ResolveAsset(0); err != nil {
+		t.Fatal(err)
+	}
+
+	asset := bundle.Assets[0]
+	for pathID, obj := range asset.Objects {
+		data, err := asset.ObjectData(pathID)
+		if err != nil {
+			t.Error(err)
+		} else if len(data) != int(obj.Size) {
+			t.Errorf("Invalid object data size. Got: %v Expected: %v", len(data), obj.Size)
+		}
+	}
+
+	if err = bundle.Close(); err != nil {
+		t.Error(err)
+	}
+	if source.closed {
+		t.Error("Close closed the caller's source")
+	}
+}
+
+func TestBundlePreload(t *testing.T) {
+	serialized := readTestSerializedFile(t, "test/main_dxt1_bc1.unity3d")
+	buf := &bytes.Buffer{}
+	nodes := []BundleNode{{Name: "CAB-test", Status: NodeStatusSerializedFile, Size: int64(len(serialized)), Data: bytes.NewReader(serialized)}}
+	if err := WriteBundle(buf, nodes, &WriteOptions{Compression: CompressionLZ4}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{1, 8} {
+		bundle, err := OpenBundle(bytes.NewReader(buf.Bytes()), int64(buf.Len()), &Options{Workers: workers})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = bundle.Preload(); err != nil {
+			t.Fatal(err)
+		}
+		if err = bundle.ResolveAsset(0); err != nil {
+			t.Fatal(err)
+		}
+
+		asset := bundle.Assets[0]
+		for _, pathID := range asset.PathIDs {
+			obj := asset.Objects[pathID]
+			data, err := asset.ObjectData(pathID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := asset.DataOffset + obj.DataOffset
+			if !bytes.Equal(data, serialized[start:start+int64(obj.Size)]) {
+				t.Errorf("Workers %v: Object %v data mismatch", workers, pathID)
+			}
+		}
+	}
+}
+
+// Preloading decompresses the blocks of a bundle with a worker pool, so it
+// should speed up with the workers up to the number of cores:
+//
+//	go test -run X -bench Preload
+func BenchmarkPreload(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	data := make([]byte, 32<<20)
+	for i := range data {
+		data[i] = 'a' + byte(r.Intn(16))
+	}
+	buf := &bytes.Buffer{}
+	nodes := []BundleNode{{Name: "CAB-test.resS", Size: int64(len(data)), Data: bytes.NewReader(data)}}
+	if err := WriteBundle(buf, nodes, &WriteOptions{Compression: CompressionLZ4}); err != nil {
+		b.Fatal(err)
+	}
+
+	for workers := 1; ; workers *= 2 {
+		if workers > runtime.NumCPU() {
+			workers = runtime.NumCPU()
+		}
+		b.Run(fmt.Sprintf("Workers=%v", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				bundle, err := OpenBundle(bytes.NewReader(buf.Bytes()), int64(buf.Len()), &Options{Workers: workers})
+				if err == nil {
+					err = bundle.Preload()
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		// As many readers as workers, each reading its part of the data
+		b.Run(fmt.Sprintf("ReadAt/Readers=%v", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				bundle, err := OpenBundle(bytes.NewReader(buf.Bytes()), int64(buf.Len()), &Options{Workers: 1})
+				if err != nil {
+					b.Fatal(err)
+				}
+				storage := bundle.storage.(*ArchiveBlockStorage)
+
+				part := storage.Size() / int64(workers)
+				var wg sync.WaitGroup
+				for reader := 0; reader < workers; reader++ {
+					wg.Add(1)
+					go func(off int64) {
+						defer wg.Done()
+						p := make([]byte, 64<<10)
+						for end := off + part; off < end; off += int64(len(p)) {
+							if _, err := storage.ReadAt(p, off); err != nil && err != io.EOF {
+								b.Error(err)
+								return
+							}
+						}
+					}(int64(reader) * part)
+				}
+				wg.Wait()
+			}
+		})
+		if workers == runtime.NumCPU() {
+			break
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package unity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	lz4 "github.com/cloudflare/golz4"
+)
+
+// Unity splits LZ4 compressed bundle data into chunks of this size
+const ChunkSizeLZ4 = 128 * 1024
+
+// Upper bound for single block compression, which must fit in an int32
+const maxBlockSize = 1 << 30
+
+// Node status of serialized files
+const NodeStatusSerializedFile = 4
+
+// A file stored in a bundle written by WriteBundle
+type BundleNode struct {
+	Name   string
+	Status int32
+	Size   int64
+	Data   io.Reader
+}
+
+type WriteOptions struct {
+	// Block compression: CompressionNone, CompressionLZMA, CompressionLZ4
+	// or CompressionLZ4HC. The block info is always LZ4HC compressed.
+	Compression      int
+	FormatVersion    int32 // Defaults to 6
+	TargetVersion    string
+	GeneratorVersion string
+}
+
+// Returns the nodes of bundle, reading their data from the bundle, so that
+// they can be written again with WriteBundle.
+func (bundle *Bundle) BundleNodes() ([]BundleNode, error) {
+	nodes := make([]BundleNode, len(bundle.Nodes))
+	for i, node := range bundle.Nodes {
+		section, err := bundle.OpenNode(i)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = BundleNode{
+			Name:   node.Name,
+			Status: node.Status,
+			Size:   node.Size,
+			Data:   section,
+		}
+	}
+	return nodes, nil
+}
+
+// Writes the nodes of bundle as a UnityFS bundle.
+func (bundle *Bundle) WriteFS(w io.Writer, compression int) error {
+	nodes, err := bundle.BundleNodes()
+	if err != nil {
+		return err
+	}
+
+	opts := &WriteOptions{
+		Compression:      compression,
+		TargetVersion:    bundle.TargetVersion,
+		GeneratorVersion: bundle.GeneratorVersion,
+	}
+	if bundle.IsArchiveStorage() {
+		opts.FormatVersion = bundle.FormatVersion
+	}
+
+	return WriteBundle(w, nodes, opts)
+}
+
+// Writes nodes as a UnityFS bundle. The node data is stored back to back
+// and split into blocks: 128KB chunks for LZ4, one block otherwise.
+func WriteBundle(w io.Writer, nodes []BundleNode, opts *WriteOptions) error {
+	o := WriteOptions{}
+	if opts != nil {
+		o = *opts
+	}
+	if o.FormatVersion == 0 {
+		o.FormatVersion = 6
+	}
+	if o.TargetVersion == "" {
+		o.TargetVersion = "5.x.x"
+	}
+
+	chunkSize := maxBlockSize
+	switch o.Compression {
+	case CompressionNone, CompressionLZMA:
+	case CompressionLZ4, CompressionLZ4HC:
+		chunkSize = ChunkSizeLZ4
+	default:
+		return fmt.Errorf("unity.WriteBundle: Unsupported compression type: %v", o.Compression)
+	}
+
+	total := int64(0)
+	for _, node := range nodes {
+		total += node.Size
+	}
+	if total < int64(chunkSize) {
+		chunkSize = int(total)
+	}
+
+	// Compress the node data into blocks
+	blocks := []ArchiveBlockInfo{}
+	data := &bytes.Buffer{}
+	chunk := make([]byte, chunkSize)
+	fill := 0
+	flush := func() error {
+		if fill == 0 {
+			return nil
+		}
+		block, compressed, err := compressBlock(chunk[:fill], o.Compression)
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, block)
+		data.Write(compressed)
+		fill = 0
+		return nil
+	}
+
+	for _, node := range nodes {
+		for remaining := node.Size; remaining > 0; {
+			n := int64(chunkSize - fill)
+			if n > remaining {
+				n = remaining
+			}
+			if _, err := io.ReadFull(node.Data, chunk[fill:fill+int(n)]); err != nil {
+				return fmt.Errorf("unity.WriteBundle: Reading node %v: %v", node.Name, err)
+			}
+			fill += int(n)
+			remaining -= n
+			if fill == chunkSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	// Block info and directory
+	be := binary.BigEndian
+	info := &bytes.Buffer{}
+	info.Write(make([]byte, 16))
+	binary.Write(info, be, int32(len(blocks)))
+	for _, block := range blocks {
+		binary.Write(info, be, block.UncompressedSize)
+		binary.Write(info, be, block.CompressedSize)
+		binary.Write(info, be, block.Flags)
+	}
+	binary.Write(info, be, int32(len(nodes)))
+	offset := int64(0)
+	for _, node := range nodes {
+		binary.Write(info, be, offset)
+		binary.Write(info, be, node.Size)
+		binary.Write(info, be, node.Status)
+		info.WriteString(node.Name + "\x00")
+		offset += node.Size
+	}
+
+	infoBlock, compressedInfo, err := compressBlock(info.Bytes(), CompressionLZ4HC)
+	if err != nil {
+		return err
+	}
+
+	// Header
+	header := &bytes.Buffer{}
+	header.WriteString(SignatureFS + "\x00")
+	binary.Write(header, be, o.FormatVersion)
+	header.WriteString(o.TargetVersion + "\x00")
+	header.WriteString(o.GeneratorVersion + "\x00")
+	headerSize := int64(header.Len()) + 8 + 4 + 4 + 4
+	padding := int64(0)
+	if o.FormatVersion >= 7 {
+		padding = (headerSize+15)&-16 - headerSize
+	}
+
+	fileSize := headerSize + padding + int64(len(compressedInfo)) + int64(data.Len())
+	binary.Write(header, be, fileSize)
+	binary.Write(header, be, uint32(len(compressedInfo)))
+	binary.Write(header, be, uint32(info.Len()))
+	binary.Write(header, be, uint32(infoBlock.Flags)|ArchiveBlocksAndDirectoryCombined)
+	header.Write(make([]byte, padding))
+
+	for _, b := range [][]byte{header.Bytes(), compressedInfo, data.Bytes()} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Compresses data into a block. Data that doesn't shrink is stored as is.
+func compressBlock(data []byte, compression int) (ArchiveBlockInfo, []byte, error) {
+	var compressed []byte
+	switch compression {
+	case CompressionLZMA:
+		var err error
+		if compressed, err = CompressLZMARaw(data); err != nil {
+			return ArchiveBlockInfo{}, nil, err
+		}
+	case CompressionLZ4, CompressionLZ4HC:
+		compressed = make([]byte, lz4.CompressBound(data))
+		compress := lz4.Compress
+		if compression == CompressionLZ4HC {
+			compress = lz4.CompressHC
+		}
+		n, err := compress(data, compressed)
+		if err != nil {
+			return ArchiveBlockInfo{}, nil, err
+		}
+		compressed = compressed[:n]
+	}
+
+	if compressed == nil || len(compressed) >= len(data) {
+		compressed = make([]byte, len(data))
+		copy(compressed, data)
+		compression = CompressionNone
+	}
+
+	block := ArchiveBlockInfo{
+		UncompressedSize: int32(len(data)),
+		CompressedSize:   int32(len(compressed)),
+		Flags:            int16(compression),
+	}
+	return block, compressed, nil
+}
@@ -0,0 +1,67 @@
+package unity
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestWriteBundle(t *testing.T) {
+	source, err := ReadBundle("test/main_dxt1_bc1.unity3d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, _ := source.OpenNode(0)
+	expected, err := ioutil.ReadAll(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, compression := range []int{CompressionNone, CompressionLZMA, CompressionLZ4, CompressionLZ4HC} {
+		buf := &bytes.Buffer{}
+		if err = source.WriteFS(buf, compression); err != nil {
+			t.Errorf("Compression %v: %v", compression, err)
+			continue
+		}
+
+		bundle, err := OpenBundle(bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil)
+		if err != nil {
+			t.Errorf("Compression %v: %v", compression, err)
+			continue
+		}
+
+		if bundle.FSFileSize != int64(buf.Len()) {
+			t.Errorf("Compression %v: Invalid file size. Got: %v Expected: %v", compression, bundle.FSFileSize, buf.Len())
+		}
+
+		if compression == CompressionLZ4 || compression == CompressionLZ4HC {
+			if len(bundle.Blocks) != (len(expected)+ChunkSizeLZ4-1)/ChunkSizeLZ4 {
+				t.Errorf("Compression %v: Invalid block count: %v", compression, len(bundle.Blocks))
+			}
+			for _, block := range bundle.Blocks {
+				if block.UncompressedSize > ChunkSizeLZ4 {
+					t.Errorf("Compression %v: Block larger than a chunk: %v", compression, block.UncompressedSize)
+				}
+			}
+		} else if len(bundle.Blocks) != 1 {
+			t.Errorf("Compression %v: Invalid block count: %v", compression, len(bundle.Blocks))
+		}
+
+		if len(bundle.Nodes) != 1 || bundle.Nodes[0].Name != source.Nodes[0].Name || bundle.Nodes[0].Status != source.Nodes[0].Status {
+			t.Errorf("Compression %v: Invalid nodes: %v", compression, bundle.Nodes)
+			continue
+		}
+
+		node, _ := bundle.OpenNode(0)
+		data, err := ioutil.ReadAll(node)
+		if err != nil {
+			t.Errorf("Compression %v: %v", compression, err)
+		} else if !bytes.Equal(data, expected) {
+			t.Errorf("Compression %v: Node data mismatch", compression)
+		}
+
+		if err = bundle.ResolveAsset(0); err != nil {
+			t.Errorf("Compression %v: %v", compression, err)
+		}
+	}
+}
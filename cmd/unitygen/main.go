@@ -0,0 +1,104 @@
+// Command unitygen generates Go structs with `field` tags from the type trees
+// of Unity files or of a type database built by unitytypedb, for use with
+// Asset.Unmarshal:
+//
+//	unitygen -o types_gen.go -skip StreamingInfo Build/
+//
+// Types whose fields changed between Unity versions get a struct for every
+// variant, and PPtr fields get a type per target, as PPtrTexture2D.
+// MonoBehaviour types are left out unless -scripts is set. Types declared by
+// hand in the package, such as Transform and GameObject in engine, must be
+// passed to -skip; engine/generate.go lists them for go generate.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/zklm/unity"
+)
+
+func main() {
+	output := flag.String("o", "", "file to write, standard output if empty")
+	pkg := flag.String("package", "engine", "package of the generated file")
+	dbPath := flag.String("db", "", "type database to read types from")
+	skip := flag.String("skip", "", "comma separated types declared elsewhere in the package")
+	scripts := flag.Bool("scripts", false, "also generate MonoBehaviour types")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [flags] [file or directory...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 && *dbPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	g := unity.NewStructGenerator(*pkg)
+	for _, name := range strings.Split(*skip, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			g.Skip[name] = true
+		}
+	}
+	include := func(classID int32) bool {
+		return *scripts || classID != int32(unity.MonoBehaviour)
+	}
+
+	if *dbPath != "" {
+		db, err := unity.LoadTypeDatabase(*dbPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		db.Each(func(version string, classID int32, tree *unity.TypeTree) {
+			if include(classID) {
+				g.Add(version, tree)
+			}
+		})
+	}
+
+	for _, path := range flag.Args() {
+		fi, err := os.Stat(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Files that fail to load are skipped
+		env := unity.NewEnvironment()
+		if fi.IsDir() {
+			err = env.LoadDir(path)
+		} else {
+			err = env.LoadFile(path)
+		}
+		if err != nil {
+			log.Print(err)
+		}
+
+		for _, asset := range env.Assets {
+			if !asset.Tree.HasTypeTrees {
+				continue
+			}
+			for _, st := range asset.Tree.SerializedTypes {
+				if st.Tree != nil && include(st.ClassID) {
+					g.Add(asset.Tree.GeneratorVersion, st.Tree)
+				}
+			}
+		}
+		env.Close()
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if _, err := g.WriteTo(w); err != nil {
+		log.Fatal(err)
+	}
+}
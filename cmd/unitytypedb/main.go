@@ -0,0 +1,77 @@
+// Command unitytypedb builds a type tree database from Unity files that
+// include type trees, such as editor builds and development player builds.
+// Files without type trees can then be decoded with the database:
+//
+//	unitytypedb -o types.db Build/ other.bundle
+//
+// Directories are searched for bundles and serialized files. With -merge,
+// the types of an existing database are kept.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/zklm/unity"
+)
+
+func main() {
+	output := flag.String("o", "types.db", "database file to write")
+	merge := flag.String("merge", "", "existing database to add the types to")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [flags] file or directory...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db := unity.NewTypeDatabase()
+	if *merge != "" {
+		var err error
+		if db, err = unity.LoadTypeDatabase(*merge); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for _, path := range flag.Args() {
+		fi, err := os.Stat(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Files that fail to load are skipped
+		env := unity.NewEnvironment()
+		if fi.IsDir() {
+			err = env.LoadDir(path)
+		} else {
+			err = env.LoadFile(path)
+		}
+		if err != nil {
+			log.Print(err)
+		}
+
+		for _, asset := range env.Assets {
+			if n := db.AddAsset(asset); n > 0 {
+				fmt.Printf("%v: %v types of Unity %v\n", asset.Name, n, asset.Tree.GeneratorVersion)
+			}
+		}
+		env.Close()
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err = db.WriteTo(f); err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %v types to %v\n", db.Len(), *output)
+}
@@ -0,0 +1,381 @@
+package unity
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// StructGenerator writes Go struct declarations for the types of type trees,
+// with `field` tags for Asset.Unmarshal. Types whose fields differ between
+// Unity versions get one struct per variant: the newest keeps the type name
+// and older ones are suffixed with the version they first appeared in, as
+// in Texture2D_5_3. PPtr fields keep their target with a type defined on
+// PPtr, as in PPtrTexture2D for PPtr<Texture2D>.
+type StructGenerator struct {
+	Package string
+
+	// Types declared elsewhere in the package, which are referenced but not
+	// written. PPtr always is.
+	Skip map[string]bool
+
+	types map[string]*genType
+	pptrs map[string]string // Unity type by Go name
+	sigs  map[*TypeTree]string
+}
+
+// A Go type and its variants by field signature
+type genType struct {
+	name     string
+	variants map[string]*genVariant
+}
+
+type genVariant struct {
+	sig      string
+	node     *TypeTree
+	versions [][3]int
+	first    string // Oldest and newest version strings
+	last     string
+	goName   string
+}
+
+func NewStructGenerator(pkg string) *StructGenerator {
+	return &StructGenerator{
+		Package: pkg,
+		Skip:    make(map[string]bool),
+		types:   make(map[string]*genType),
+		pptrs:   make(map[string]string),
+		sigs:    make(map[*TypeTree]string),
+	}
+}
+
+// Adds the structured types of the type tree of a class for a Unity version.
+func (g *StructGenerator) Add(version string, tree *TypeTree) {
+	v, _ := parseUnityVersion(version)
+	g.collect(tree, version, v)
+}
+
+func (g *StructGenerator) collect(node *TypeTree, version string, v [3]int) {
+	if g.kind(node) == genPPtr {
+		g.pptrs[goIdentifier(node.Type)] = node.Type
+	}
+	if g.kind(node) == genStruct {
+		name := goIdentifier(node.Type)
+		t, found := g.types[name]
+		if !found {
+			t = &genType{name: name, variants: make(map[string]*genVariant)}
+			g.types[name] = t
+		}
+
+		sig := g.signature(node)
+		variant, found := t.variants[sig]
+		if !found {
+			variant = &genVariant{sig: sig, node: node, first: version, last: version}
+			t.variants[sig] = variant
+		}
+		if len(variant.versions) > 0 {
+			if compareUnityVersions(v, variant.minVersion()) < 0 {
+				variant.first = version
+			}
+			if compareUnityVersions(v, variant.maxVersion()) > 0 {
+				variant.last = version
+			}
+		}
+		variant.versions = append(variant.versions, v)
+	}
+
+	for _, child := range node.Children {
+		g.collect(child, version, v)
+	}
+}
+
+func (v *genVariant) minVersion() [3]int {
+	min := v.versions[0]
+	for _, version := range v.versions {
+		if compareUnityVersions(version, min) < 0 {
+			min = version
+		}
+	}
+	return min
+}
+
+func (v *genVariant) maxVersion() [3]int {
+	max := v.versions[0]
+	for _, version := range v.versions {
+		if compareUnityVersions(version, max) > 0 {
+			max = version
+		}
+	}
+	return max
+}
+
+const (
+	genPrimitive = iota
+	genString
+	genArray     // Array node
+	genContainer // vector, map and other nodes holding an array
+	genPair
+	genPPtr
+	genStruct
+)
+
+// Classifies a node as the value decoder does.
+func (g *StructGenerator) kind(node *TypeTree) int {
+	switch {
+	case node.IsArray:
+		return genArray
+	case node.Type == "string" && len(node.Children) == 1:
+		return genString
+	case len(node.Children) == 1 && node.Children[0].IsArray:
+		return genContainer
+	case node.Type == "pair" && len(node.Children) == 2:
+		return genPair
+	case strings.HasPrefix(node.Type, "PPtr<") && len(node.Children) == 2:
+		return genPPtr
+	case len(node.Children) > 0:
+		return genStruct
+	}
+	return genPrimitive
+}
+
+// Returns a string identifying the Go shape of a node
+func (g *StructGenerator) signature(node *TypeTree) string {
+	if sig, found := g.sigs[node]; found {
+		return sig
+	}
+
+	sig := g.typeExpr(node, "", func(n *TypeTree) string {
+		var b strings.Builder
+		b.WriteString(goIdentifier(n.Type) + "{")
+		for _, child := range n.Children {
+			b.WriteString(child.Name + ":" + g.signature(child) + ";")
+		}
+		b.WriteString("}")
+		return b.String()
+	})
+	g.sigs[node] = sig
+	return sig
+}
+
+// Returns the Go type of a node, naming structs with structName. Maps are
+// only used for map containers.
+func (g *StructGenerator) typeExpr(node *TypeTree, container string, structName func(*TypeTree) string) string {
+	switch g.kind(node) {
+	case genString:
+		return "string"
+	case genContainer:
+		return g.typeExpr(node.Children[0], node.Type, structName)
+	case genPPtr:
+		return goIdentifier(node.Type)
+	case genStruct:
+		return structName(node)
+
+	case genPair:
+		return fmt.Sprintf("struct {\nFirst %v `field:\"first\"`\nSecond %v `field:\"second\"`\n}",
+			g.typeExpr(node.Children[0], "", structName), g.typeExpr(node.Children[1], "", structName))
+
+	case genArray:
+		if len(node.Children) != 2 {
+			return "interface{}"
+		}
+		element := node.Children[1]
+		if len(element.Children) == 0 && element.Size == 1 && isByteType(element.Type) && !element.Aligned() {
+			return "[]byte"
+		}
+		if container == "map" && g.kind(element) == genPair {
+			key := g.typeExpr(element.Children[0], "", structName)
+			if isComparableGoType(key) {
+				return "map[" + key + "]" + g.typeExpr(element.Children[1], "", structName)
+			}
+		}
+		return "[]" + g.typeExpr(element, "", structName)
+	}
+
+	if t, found := goPrimitiveTypes[node.Type]; found {
+		return t
+	}
+	if node.Size > 0 {
+		return fmt.Sprintf("[%v]byte", node.Size)
+	}
+	return "interface{}"
+}
+
+var goPrimitiveTypes = map[string]string{
+	"bool":               "bool",
+	"SInt8":              "int8",
+	"UInt8":              "uint8",
+	"char":               "uint8",
+	"SInt16":             "int16",
+	"short":              "int16",
+	"UInt16":             "uint16",
+	"unsigned short":     "uint16",
+	"SInt32":             "int32",
+	"int":                "int32",
+	"Type*":              "int32",
+	"UInt32":             "uint32",
+	"unsigned int":       "uint32",
+	"SInt64":             "int64",
+	"long long":          "int64",
+	"UInt64":             "uint64",
+	"unsigned long long": "uint64",
+	"FileSize":           "uint64",
+	"float":              "float32",
+	"double":             "float64",
+}
+
+func isComparableGoType(t string) bool {
+	if t == "string" {
+		return true
+	}
+	for _, primitive := range goPrimitiveTypes {
+		if t == primitive {
+			return true
+		}
+	}
+	return false
+}
+
+// Names the variants of every type, the newest keeping the type name.
+func (g *StructGenerator) assignNames() {
+	for _, t := range g.types {
+		variants := t.sortedVariants()
+		taken := make(map[string]bool)
+		for i, variant := range variants {
+			if i == 0 {
+				variant.goName = t.name
+				taken[t.name] = true
+				continue
+			}
+
+			min := variant.minVersion()
+			name := fmt.Sprintf("%v_%v_%v", t.name, min[0], min[1])
+			if taken[name] {
+				name = fmt.Sprintf("%v_%v_%v_%v", t.name, min[0], min[1], min[2])
+			}
+			for n := 2; taken[name]; n++ {
+				name = fmt.Sprintf("%v_%v_%v_%v_%v", t.name, min[0], min[1], min[2], n)
+			}
+			variant.goName = name
+			taken[name] = true
+		}
+	}
+}
+
+// Variants from the newest to the oldest
+func (t *genType) sortedVariants() []*genVariant {
+	variants := make([]*genVariant, 0, len(t.variants))
+	for _, variant := range t.variants {
+		variants = append(variants, variant)
+	}
+	sort.Slice(variants, func(i, j int) bool {
+		if c := compareUnityVersions(variants[i].maxVersion(), variants[j].maxVersion()); c != 0 {
+			return c > 0
+		}
+		if c := compareUnityVersions(variants[i].minVersion(), variants[j].minVersion()); c != 0 {
+			return c > 0
+		}
+		return variants[i].sig < variants[j].sig
+	})
+	return variants
+}
+
+// Writes the formatted Go source of every added type.
+func (g *StructGenerator) WriteTo(w io.Writer) (int64, error) {
+	g.assignNames()
+	structName := func(node *TypeTree) string {
+		name := goIdentifier(node.Type)
+		if g.Skip[name] {
+			return name
+		}
+		return g.types[name].variants[g.signature(node)].goName
+	}
+
+	var names []string
+	for name := range g.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by unitygen. DO NOT EDIT.\n\npackage %v\n", g.Package)
+
+	var pptrs []string
+	for name := range g.pptrs {
+		if !g.Skip[name] {
+			pptrs = append(pptrs, name)
+		}
+	}
+	sort.Strings(pptrs)
+	for _, name := range pptrs {
+		fmt.Fprintf(&b, "\n// %v\ntype %v PPtr\n", g.pptrs[name], name)
+	}
+
+	for _, name := range names {
+		if name == "PPtr" || g.Skip[name] {
+			continue
+		}
+
+		for _, variant := range g.types[name].sortedVariants() {
+			if variant.first == variant.last {
+				fmt.Fprintf(&b, "\n// %v of Unity %v\n", variant.node.Type, variant.first)
+			} else {
+				fmt.Fprintf(&b, "\n// %v of Unity %v to %v\n", variant.node.Type, variant.first, variant.last)
+			}
+			fmt.Fprintf(&b, "type %v struct {\n", variant.goName)
+
+			fields := make(map[string]bool)
+			for _, child := range variant.node.Children {
+				fieldName := goFieldName(child.Name)
+				for n := 2; fields[fieldName]; n++ {
+					fieldName = fmt.Sprintf("%v%v", goFieldName(child.Name), n)
+				}
+				fields[fieldName] = true
+
+				fmt.Fprintf(&b, "%v %v `field:%q`\n", fieldName, g.typeExpr(child, "", structName), child.Name)
+			}
+			b.WriteString("}\n")
+		}
+	}
+
+	source, err := format.Source(b.Bytes())
+	if err != nil {
+		return 0, fmt.Errorf("unity.StructGenerator.WriteTo: %w", err)
+	}
+	n, err := w.Write(source)
+	return int64(n), err
+}
+
+// Returns an exported Go identifier for a Unity type or field name.
+func goIdentifier(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+
+	id := b.String()
+	if id == "" || unicode.IsDigit([]rune(id)[0]) {
+		id = "X" + id
+	}
+	return id
+}
+
+// Returns a field name for a Unity field name without its m_ prefix.
+func goFieldName(name string) string {
+	if strings.HasPrefix(name, "m_") && len(name) > 2 {
+		name = name[2:]
+	}
+	return goIdentifier(name)
+}
@@ -0,0 +1,92 @@
+package unity
+
+import (
+	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+func TestStructGenerator(t *testing.T) {
+	g := NewStructGenerator("engine")
+	g.Skip["StreamingInfo"] = true
+	for _, path := range []string{"test/20147_cs_h", "test/main_dxt1_bc1.unity3d"} {
+		data := readTestSerializedFile(t, path)
+		asset, err := OpenAsset(bytes.NewReader(data), int64(len(data)), "CAB")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, st := range asset.Tree.SerializedTypes {
+			g.Add(asset.Tree.GeneratorVersion, st.Tree)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := g.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	source := buf.String()
+
+	// The output compiles with the skipped types declared elsewhere
+	fset := token.NewFileSet()
+	generated, err := parser.ParseFile(fset, "types_gen.go", source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stubs, _ := parser.ParseFile(fset, "stubs.go", "package engine\ntype PPtr struct{}\ntype StreamingInfo struct{}\n", 0)
+	conf := types.Config{Importer: importer.Default()}
+	pkg, err := conf.Check("engine", fset, []*ast.File{generated, stubs}, nil)
+	if err != nil {
+		t.Fatalf("%v\n%v", err, source)
+	}
+
+	// Texture2D lost m_ReadAllowed after Unity 5.3
+	for _, name := range []string{"AssetBundle", "AssetInfo", "GLTextureSettings", "TextAsset", "Texture2D", "Texture2D_5_3"} {
+		if pkg.Scope().Lookup(name) == nil {
+			t.Errorf("Type %v not generated", name)
+		}
+	}
+	if strings.Contains(source, "type StreamingInfo") || strings.Contains(source, "type PPtr struct") {
+		t.Error("Skipped types generated")
+	}
+
+	expected := []string{
+		"ReadAllowed       bool              `field:\"m_ReadAllowed\"`",
+		"ImageData         []byte            `field:\"image data\"`",
+		"Container                  map[string]AssetInfo `field:\"m_Container\"`",
+		"Asset        PPtrObject `field:\"asset\"`",
+		"// PPtr<Object>\ntype PPtrObject PPtr\n",
+		"// Texture2D of Unity 5.3.8p2\n",
+	}
+	for _, s := range expected {
+		if !strings.Contains(source, s) {
+			t.Errorf("Expected %q in the output:\n%v", s, source)
+		}
+	}
+	if strings.Count(source, `field:"m_ReadAllowed"`) != 1 {
+		t.Error("Expected m_ReadAllowed in the Unity 5.3 variant only")
+	}
+}
+
+func TestGoIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"m_Name":          "Name",
+		"image data":      "ImageData",
+		"first":           "First",
+		"m_LocalPosition": "LocalPosition",
+		"1st":             "X1st",
+		"m_":              "M",
+	}
+	for name, expected := range tests {
+		if got := goFieldName(name); got != expected {
+			t.Errorf("goFieldName(%q): Got: %q Expected: %q", name, got, expected)
+		}
+	}
+	if got := goIdentifier("Generic Mono"); got != "GenericMono" {
+		t.Errorf("Invalid type name: %q", got)
+	}
+}
@@ -6,8 +6,16 @@ type Object struct {
 
 type GameObject struct {
 	Object
-	Active bool
-	Component
-	Layer int32
-	Tag   uint16
+	Active    bool        `field:"m_IsActive"`
+	Component `field:"-"` // Not stored for GameObjects
+	Layer     int32
+	Tag       uint16
+
+	Components []ComponentPair `field:"m_Component"`
+	Name       string
+}
+
+// Component of a GameObject, since Unity 5.5
+type ComponentPair struct {
+	Component PPtr `field:"component"`
 }
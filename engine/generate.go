@@ -0,0 +1,5 @@
+package engine
+
+// types_gen.go holds the types of the test files. Types written by hand in
+// this package are skipped, and must be added to -skip when they are.
+//go:generate go run ../cmd/unitygen -o types_gen.go -skip Object,Component,Behaviour,Transform,GameObject,ComponentPair,StreamingInfo,StreamedResource ../test
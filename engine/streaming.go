@@ -0,0 +1,15 @@
+package engine
+
+// Location of texture and mesh data kept in a .resS file
+type StreamingInfo struct {
+	Offset uint64 `field:"offset"`
+	Size   uint32 `field:"size"`
+	Path   string `field:"path"`
+}
+
+// Location of audio and video data kept in a .resource file
+type StreamedResource struct {
+	Source string `field:"m_Source"`
+	Offset uint64 `field:"m_Offset"`
+	Size   uint64 `field:"m_Size"`
+}
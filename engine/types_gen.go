@@ -0,0 +1,77 @@
+// Code generated by unitygen. DO NOT EDIT.
+
+package engine
+
+// PPtr<Object>
+type PPtrObject PPtr
+
+// AssetBundle of Unity 5.3.8p2 to 5.6.1f1
+type AssetBundle struct {
+	Name                       string               `field:"m_Name"`
+	PreloadTable               []PPtrObject         `field:"m_PreloadTable"`
+	Container                  map[string]AssetInfo `field:"m_Container"`
+	MainAsset                  AssetInfo            `field:"m_MainAsset"`
+	RuntimeCompatibility       uint32               `field:"m_RuntimeCompatibility"`
+	AssetBundleName            string               `field:"m_AssetBundleName"`
+	Dependencies               []string             `field:"m_Dependencies"`
+	IsStreamedSceneAssetBundle bool                 `field:"m_IsStreamedSceneAssetBundle"`
+}
+
+// AssetInfo of Unity 5.3.8p2 to 5.6.1f1
+type AssetInfo struct {
+	PreloadIndex int32      `field:"preloadIndex"`
+	PreloadSize  int32      `field:"preloadSize"`
+	Asset        PPtrObject `field:"asset"`
+}
+
+// GLTextureSettings of Unity 5.3.8p2 to 5.6.1f1
+type GLTextureSettings struct {
+	FilterMode int32   `field:"m_FilterMode"`
+	Aniso      int32   `field:"m_Aniso"`
+	MipBias    float32 `field:"m_MipBias"`
+	WrapMode   int32   `field:"m_WrapMode"`
+}
+
+// TextAsset of Unity 5.6.1f1
+type TextAsset struct {
+	Name     string `field:"m_Name"`
+	Script   string `field:"m_Script"`
+	PathName string `field:"m_PathName"`
+}
+
+// Texture2D of Unity 5.6.1f1
+type Texture2D struct {
+	Name              string            `field:"m_Name"`
+	Width             int32             `field:"m_Width"`
+	Height            int32             `field:"m_Height"`
+	CompleteImageSize int32             `field:"m_CompleteImageSize"`
+	TextureFormat     int32             `field:"m_TextureFormat"`
+	MipCount          int32             `field:"m_MipCount"`
+	IsReadable        bool              `field:"m_IsReadable"`
+	ImageCount        int32             `field:"m_ImageCount"`
+	TextureDimension  int32             `field:"m_TextureDimension"`
+	TextureSettings   GLTextureSettings `field:"m_TextureSettings"`
+	LightmapFormat    int32             `field:"m_LightmapFormat"`
+	ColorSpace        int32             `field:"m_ColorSpace"`
+	ImageData         []byte            `field:"image data"`
+	StreamData        StreamingInfo     `field:"m_StreamData"`
+}
+
+// Texture2D of Unity 5.3.8p2
+type Texture2D_5_3 struct {
+	Name              string            `field:"m_Name"`
+	Width             int32             `field:"m_Width"`
+	Height            int32             `field:"m_Height"`
+	CompleteImageSize int32             `field:"m_CompleteImageSize"`
+	TextureFormat     int32             `field:"m_TextureFormat"`
+	MipCount          int32             `field:"m_MipCount"`
+	IsReadable        bool              `field:"m_IsReadable"`
+	ReadAllowed       bool              `field:"m_ReadAllowed"`
+	ImageCount        int32             `field:"m_ImageCount"`
+	TextureDimension  int32             `field:"m_TextureDimension"`
+	TextureSettings   GLTextureSettings `field:"m_TextureSettings"`
+	LightmapFormat    int32             `field:"m_LightmapFormat"`
+	ColorSpace        int32             `field:"m_ColorSpace"`
+	ImageData         []byte            `field:"image data"`
+	StreamData        StreamingInfo     `field:"m_StreamData"`
+}
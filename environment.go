@@ -0,0 +1,248 @@
+package unity
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/zklm/unity/engine"
+)
+
+// Environment holds the bundles and serialized files of a game and links
+// them through the external references of each asset.
+type Environment struct {
+	Bundles []*Bundle
+	Assets  []*Asset
+
+	// Options of every bundle and serialized file loaded, defaults if nil
+	Options *Options
+
+	// Loaded assets by lower case name and path
+	index map[string]*Asset
+	// Targets of each asset's external references, nil if not loaded
+	externals map[*Asset][]*Asset
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{
+		index:     make(map[string]*Asset),
+		externals: make(map[*Asset][]*Asset),
+	}
+}
+
+// LoadError lists the files and directories LoadDir couldn't read. They are
+// skipped and everything else is loaded.
+type LoadError struct {
+	Paths  []string
+	Errors []error
+}
+
+func (e *LoadError) Error() string {
+	parts := make([]string, len(e.Paths))
+	for i, path := range e.Paths {
+		parts[i] = fmt.Sprintf("%v: %v", path, e.Errors[i])
+	}
+	return "unity.Environment.LoadDir: " + strings.Join(parts, "; ")
+}
+
+func (e *LoadError) Unwrap() []error {
+	return e.Errors
+}
+
+// Loads every bundle and serialized file below dir, recognized by their
+// signatures. Split files are loaded once from their parts. Files that fail
+// to load are reported in a *LoadError once the others are loaded.
+func (env *Environment) LoadDir(dir string) error {
+	loaded := map[string]bool{}
+	loadErr := &LoadError{}
+	fail := func(path string, err error) {
+		loadErr.Paths = append(loadErr.Paths, path)
+		loadErr.Errors = append(loadErr.Errors, err)
+	}
+
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			fail(path, err)
+			return nil
+		}
+		if fi.IsDir() {
+			return nil
+		}
+
+		base, _ := splitBase(path)
+		if loaded[base] {
+			return nil
+		}
+		loaded[base] = true
+
+		if err = env.loadFile(base, dir); err != nil {
+			fail(path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	env.Link()
+	if len(loadErr.Paths) > 0 {
+		return loadErr
+	}
+	return nil
+}
+
+// Loads the bundle or serialized file at path.
+func (env *Environment) LoadFile(path string) error {
+	if err := env.loadFile(path, filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	env.Link()
+	return nil
+}
+
+// Loads the Unity content at path, if any. Serialized files are also
+// indexed by their path relative to root.
+func (env *Environment) loadFile(path string, root string) error {
+	r, size, err := openFile(path)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, 48)
+	n, _ := r.ReadAt(header, 0)
+	header = header[:n]
+	r.Close()
+
+	for _, sig := range []string{SignatureFS, SignatureWeb, SignatureRaw, SignatureArchive, SignatureWebData} {
+		if bytes.HasPrefix(header, []byte(sig+"\x00")) {
+			bundle, err := OpenBundleFile(path, env.Options)
+			if err != nil {
+				return err
+			}
+			if err = env.AddBundle(bundle); err != nil {
+				bundle.Close()
+				return err
+			}
+			return nil
+		}
+	}
+
+	if !IsSerializedFile(header, size) {
+		return nil
+	}
+
+	asset, err := openAssetFile(path, env.Options)
+	if err != nil {
+		return err
+	}
+	env.AddAsset(asset)
+
+	if rel, err := filepath.Rel(root, asset.Path); err == nil {
+		env.index[strings.ToLower(filepath.ToSlash(rel))] = asset
+	}
+
+	return nil
+}
+
+// Loads the serialized files of bundle and adds them to the environment.
+// Nothing is added if one of them fails to load.
+func (env *Environment) AddBundle(bundle *Bundle) error {
+	for i := range bundle.Assets {
+		if err := bundle.ResolveAsset(i); err != nil {
+			return err
+		}
+	}
+
+	for _, asset := range bundle.Assets {
+		if !asset.IsResource() {
+			env.AddAsset(asset)
+			env.index[strings.ToLower(archivePrefix+asset.Name+"/"+asset.Name)] = asset
+		}
+	}
+
+	env.Bundles = append(env.Bundles, bundle)
+	return nil
+}
+
+// Adds a loaded serialized file to the environment.
+func (env *Environment) AddAsset(asset *Asset) {
+	env.Assets = append(env.Assets, asset)
+	env.index[strings.ToLower(asset.Name)] = asset
+}
+
+// Returns the loaded asset with the given name, path or archive:/ path.
+func (env *Environment) Find(name string) *Asset {
+	name = strings.ToLower(filepath.ToSlash(name))
+	if asset, found := env.index[name]; found {
+		return asset
+	}
+	return env.index[path.Base(name)]
+}
+
+// Maps the external references of every asset to the loaded assets they
+// point to. It runs after each load, and again should assets be added
+// directly.
+func (env *Environment) Link() {
+	for _, asset := range env.Assets {
+		targets := make([]*Asset, len(asset.AssetRefs))
+		for i, ref := range asset.AssetRefs {
+			targets[i] = env.Find(ref.FilePath)
+		}
+		env.externals[asset] = targets
+	}
+}
+
+// Returns the asset a file ID of asset refers to: 0 is the asset itself, any
+// other value an entry of its external references.
+func (env *Environment) ResolveFileID(asset *Asset, fileID int32) (*Asset, error) {
+	if fileID == 0 {
+		return asset, nil
+	}
+
+	targets := env.externals[asset]
+	if fileID < 0 || int(fileID) > len(asset.AssetRefs) {
+		return nil, fmt.Errorf("unity.Environment.ResolveFileID: Invalid file ID %v in %v", fileID, asset.Name)
+	}
+	if int(fileID) > len(targets) || targets[fileID-1] == nil {
+		return nil, fmt.Errorf("unity.Environment.ResolveFileID: %v is not loaded", asset.AssetRefs[fileID-1].FilePath)
+	}
+
+	return targets[fileID-1], nil
+}
+
+// Returns the asset and object a PPtr read from asset points to.
+func (env *Environment) ResolvePPtr(asset *Asset, ptr engine.PPtr) (*Asset, ObjectInfo, error) {
+	target, err := env.ResolveFileID(asset, ptr.FileID)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	obj, found := target.Objects[ptr.PathID]
+	if !found {
+		return nil, ObjectInfo{}, fmt.Errorf("unity.Environment.ResolvePPtr: Object %v not found in %v", ptr.PathID, target.Name)
+	}
+
+	return target, obj, nil
+}
+
+// Closes every bundle and asset of the environment.
+func (env *Environment) Close() (err error) {
+	for _, bundle := range env.Bundles {
+		if cerr := bundle.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	for _, asset := range env.Assets {
+		if cerr := asset.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
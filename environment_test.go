@@ -0,0 +1,147 @@
+package unity
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zklm/unity/engine"
+)
+
+func TestEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundleData, err := ioutil.ReadFile("test/20147_cs_h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Mkdir(filepath.Join(dir, "StreamingAssets"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "StreamingAssets", "textures.bundle"), bundleData, 0644)
+
+	assetData := readTestSerializedFile(t, "test/main_dxt1_bc1.unity3d")
+	writeSplitFile(t, filepath.Join(dir, "sharedassets0.assets"), assetData, 100000)
+	ioutil.WriteFile(filepath.Join(dir, "app.info"), []byte("company\nproduct"), 0644)
+
+	env := NewEnvironment()
+	defer env.Close()
+	if err = env.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(env.Bundles) != 1 || len(env.Assets) != 2 {
+		t.Fatalf("Invalid bundle or asset count. Got: %v, %v Expected: 1, 2", len(env.Bundles), len(env.Assets))
+	}
+
+	cab := "CAB-be1d08a614f11a49e601c02ba4c4f640"
+	shared := env.Find("sharedassets0.assets")
+	if shared == nil {
+		t.Fatal("sharedassets0.assets not found")
+	}
+	if env.Find("archive:/"+cab+"/"+cab) != env.Find(cab) || env.Find(cab) == nil {
+		t.Fatalf("%v not found", cab)
+	}
+
+	shared.AssetRefs = append(shared.AssetRefs,
+		&AssetRef{FilePath: "archive:/" + cab + "/" + cab},
+		&AssetRef{FilePath: "library/unity default resources"})
+	env.Link()
+
+	target, err := env.ResolveFileID(shared, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Name != cab {
+		t.Errorf("Invalid file ID target. Got: %v Expected: %v", target.Name, cab)
+	}
+
+	if _, err = env.ResolveFileID(shared, 2); err == nil {
+		t.Error("Expected an error for a reference that isn't loaded")
+	}
+
+	_, obj, err := env.ResolvePPtr(shared, engine.PPtr{FileID: 1, PathID: 1})
+	if err != nil {
+		t.Error(err)
+	} else if obj.ClassID != 142 {
+		t.Errorf("Invalid PPtr target class. Got: %v Expected: 142", obj.ClassID)
+	}
+}
+
+func TestLoadDirErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundleData, err := ioutil.ReadFile("test/20147_cs_h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "a.bundle"), bundleData, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "b.bundle"), bundleData[:200], 0644)
+
+	// A bundle whose serialized file is corrupted
+	serialized := make([]byte, 64)
+	copy(serialized[8:], []byte{0, 0, 0, 64, 0, 0, 0, 22})
+	ioutil.WriteFile(filepath.Join(dir, "c.bundle"), makeRawBundle(t, SignatureRaw, []string{"CAB-c"}, [][]byte{serialized}), 0644)
+
+	env := NewEnvironment()
+	defer env.Close()
+	err = env.LoadDir(dir)
+
+	var loadErr *LoadError
+	if !errors.As(err, &loadErr) {
+		t.Fatalf("Expected a *LoadError. Got: %v", err)
+	}
+	if len(loadErr.Paths) != 2 || filepath.Base(loadErr.Paths[0]) != "b.bundle" || filepath.Base(loadErr.Paths[1]) != "c.bundle" {
+		t.Errorf("Invalid failed paths: %v", loadErr.Paths)
+	}
+	if len(env.Bundles) != 1 || len(env.Assets) != 1 {
+		t.Errorf("Invalid bundle or asset count. Got: %v, %v Expected: 1, 1", len(env.Bundles), len(env.Assets))
+	}
+}
+
+func TestEnvironmentOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundleData, err := ioutil.ReadFile("test/20147_cs_h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "textures.bundle"), bundleData, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sharedassets0.assets"), readTestSerializedFile(t, "test/main_dxt1_bc1.unity3d"), 0644)
+
+	// Every file is opened with the options
+	cache := NewBlockCache(1 << 20)
+	db := NewTypeDatabase()
+	env := NewEnvironment()
+	env.Options = &Options{BlockCache: cache, TypeDatabase: db}
+	if err = env.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if len(env.Bundles) != 1 || env.Bundles[0].options.BlockCache != cache {
+		t.Error("Bundle not opened with the options")
+	}
+	if shared := env.Find("sharedassets0.assets"); shared == nil || shared.typeDatabase() != db {
+		t.Error("Serialized file not opened with the options")
+	}
+	env.Close()
+
+	env = NewEnvironment()
+	defer env.Close()
+	env.Options = &Options{Limits: Limits{MaxNodeCount: 1}}
+	var loadErr *LoadError
+	if err = env.LoadDir(dir); !errors.As(err, &loadErr) || len(loadErr.Paths) != 2 {
+		t.Errorf("Expected both files to fail within the limits. Got: %v", err)
+	}
+}
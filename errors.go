@@ -0,0 +1,81 @@
+package unity
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Parsing stages reported by FormatError
+const (
+	StageHeader     = "header"
+	StageBlockInfo  = "block info"
+	StageDirectory  = "directory"
+	StageBlock      = "block"
+	StageMetadata   = "metadata"
+	StageTypeTree   = "type tree"
+	StageObjectInfo = "object info"
+	StageExternals  = "externals"
+)
+
+// FormatError reports malformed or truncated bundle and serialized file
+// data. Offset is the position of the failed read within the file, within
+// Node for serialized files stored in a bundle, or within the uncompressed
+// block info or block for those stages.
+type FormatError struct {
+	File   string
+	Node   string
+	Offset int64
+	Stage  string
+	Err    error
+}
+
+func (e *FormatError) Error() string {
+	location := e.File
+	if e.Node != "" {
+		if location != "" {
+			location += ":"
+		}
+		location += e.Node
+	}
+	if location != "" {
+		location += " "
+	}
+	return fmt.Sprintf("unity: %s%s at offset %v: %v", location, e.Stage, e.Offset, e.Err)
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
+
+// Wraps err as a *FormatError at offset unless it already is one. Short
+// reads are reported as io.ErrUnexpectedEOF.
+func formatError(stage string, offset int64, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var fe *FormatError
+	if errors.As(err, &fe) {
+		return err
+	}
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return &FormatError{Stage: stage, Offset: offset, Err: err}
+}
+
+// Sets the file and node of a *FormatError in err where they are unknown.
+func setErrorLocation(err error, file, node string) error {
+	var fe *FormatError
+	if errors.As(err, &fe) {
+		if fe.File == "" {
+			fe.File = file
+		}
+		if fe.Node == "" {
+			fe.Node = node
+		}
+	}
+	return err
+}
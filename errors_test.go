@@ -0,0 +1,71 @@
+package unity
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFormatError(t *testing.T) {
+	data, err := ioutil.ReadFile("test/main_dxt1_bc1.unity3d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Truncated bundle file
+	f, err := ioutil.TempFile("", "unityfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(data[:40])
+	f.Close()
+
+	var fe *FormatError
+	if _, err = ReadBundle(f.Name()); !errors.As(err, &fe) {
+		t.Errorf("Expected a *FormatError for a truncated bundle. Got: %v", err)
+	} else {
+		if fe.File != f.Name() || fe.Stage != StageHeader {
+			t.Errorf("Invalid error location. File: %v Stage: %v", fe.File, fe.Stage)
+		}
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Expected io.ErrUnexpectedEOF. Got: %v", fe.Err)
+		}
+	}
+
+	// Corrupted data blocks fail when the asset is loaded
+	serialized := readTestSerializedFile(t, "test/main_dxt1_bc1.unity3d")
+	buf := &bytes.Buffer{}
+	nodes := []BundleNode{{Name: "CAB-test", Status: NodeStatusSerializedFile, Size: int64(len(serialized)), Data: bytes.NewReader(serialized)}}
+	if err = WriteBundle(buf, nodes, &WriteOptions{Compression: CompressionLZ4}); err != nil {
+		t.Fatal(err)
+	}
+	corrupted := buf.Bytes()
+	bundle, err := OpenBundle(bytes.NewReader(corrupted), int64(len(corrupted)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataSize := 0
+	for _, block := range bundle.Blocks {
+		dataSize += int(block.CompressedSize)
+	}
+	for i := len(corrupted) - dataSize; i < len(corrupted); i++ {
+		corrupted[i] = 0xff
+	}
+
+	if err = bundle.ResolveAsset(0); !errors.As(err, &fe) {
+		t.Errorf("Expected a *FormatError for a corrupted block. Got: %v", err)
+	} else if fe.Stage != StageBlock || fe.Node != "CAB-test" {
+		t.Errorf("Invalid error location. Node: %v Stage: %v", fe.Node, fe.Stage)
+	}
+
+	// Truncated serialized file metadata
+	if _, err = OpenAsset(bytes.NewReader(serialized[:2600]), 2600, "CAB"); !errors.As(err, &fe) {
+		t.Errorf("Expected a *FormatError for truncated metadata. Got: %v", err)
+	} else if fe.File != "CAB" || fe.Offset <= 20 || fe.Offset > 2600 {
+		t.Errorf("Invalid error location. File: %v Offset: %v", fe.File, fe.Offset)
+	}
+}
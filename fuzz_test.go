@@ -0,0 +1,114 @@
+package unity
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+// Small limits keep fuzzed inputs from spending time on huge allocations
+var fuzzLimits = Limits{
+	MaxAllocation:       1 << 20,
+	MaxNodeCount:        1 << 12,
+	MaxDecompressedSize: 1 << 22,
+}
+
+// ReadBundle reads the file into memory and opens it with OpenBundle.
+func FuzzReadBundle(f *testing.F) {
+	for _, path := range []string{"test/20147_cs_h", "test/main_dxt1_bc1.unity3d"} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data[:4096])
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		bundle, err := OpenBundle(bytes.NewReader(data), int64(len(data)), &Options{Limits: fuzzLimits})
+		if err != nil {
+			return
+		}
+		for i := range bundle.Assets {
+			bundle.ResolveAsset(i)
+		}
+	})
+}
+
+func FuzzReadTypeMetadata(f *testing.F) {
+	for _, path := range []string{"test/20147_cs_h", "test/main_dxt1_bc1.unity3d"} {
+		data := readTestSerializedFile(f, path)
+		asset, err := OpenAsset(bytes.NewReader(data), int64(len(data)), "CAB")
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data[20:asset.DataOffset], asset.Format, asset.IsLittleEndian)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, format uint32, isLittleEndian bool) {
+		reader, _ := NewReader(data)
+		reader.ChangeEndian(isLittleEndian)
+		readTypeMetadata(reader, isLittleEndian, format%32, fuzzLimits)
+	})
+}
+
+func FuzzReadObjectInfo(f *testing.F) {
+	for _, format := range []uint32{9, 14, 15, 16, 17, 22} {
+		asset := &Asset{Format: format, IsLittleEndian: true}
+		w := NewWriter()
+		w.ChangeEndian(true)
+		obj := ObjectInfo{PathID: 1, DataOffset: 16, Size: 32, TypeID: 28, ClassID: 28, TypeIndex: 1}
+		obj.write(asset, w)
+		f.Add(w.Data(), format, false)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, format uint32, longObjectIDs bool) {
+		asset := &Asset{
+			Format:        format % 32,
+			LongObjectIDs: longObjectIDs,
+			Tree:          &TypeMetadata{ClassIDs: []int32{1, 28, -2}},
+		}
+		reader, _ := NewReader(data)
+		reader.ChangeEndian(true)
+		obj, err := ReadObjectInfo(asset, reader)
+		if err == nil && asset.Format >= 16 && int(obj.TypeIndex) >= len(asset.Tree.ClassIDs) {
+			t.Errorf("Undefined type index accepted: %v", obj.TypeIndex)
+		}
+	})
+}
+
+func TestLimits(t *testing.T) {
+	data, err := ioutil.ReadFile("test/main_dxt1_bc1.unity3d")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits := []Limits{
+		{MaxAllocation: 1024},
+		{MaxDecompressedSize: 1024},
+		{MaxNodeCount: 2},
+	}
+	for _, l := range limits {
+		bundle, err := OpenBundle(bytes.NewReader(data), int64(len(data)), &Options{Limits: l})
+		if err == nil {
+			err = bundle.ResolveAsset(0)
+		}
+
+		var fe *FormatError
+		if !errors.Is(err, ErrLimitExceeded) || !errors.As(err, &fe) {
+			t.Errorf("%+v: Expected a limit error. Got: %v", l, err)
+		}
+	}
+
+	// Unset limits use the defaults
+	bundle, err := OpenBundle(bytes.NewReader(data), int64(len(data)), &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle.options.Limits != DefaultLimits {
+		t.Errorf("Invalid default limits: %+v", bundle.options.Limits)
+	}
+	if err = bundle.ResolveAsset(0); err != nil {
+		t.Error(err)
+	}
+}
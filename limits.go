@@ -0,0 +1,95 @@
+package unity
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Returned, wrapped, when a file exceeds one of its Limits
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// Limits bound what a malformed or malicious file can make the parser
+// allocate. They are checked before allocating. Zero fields use the values
+// of DefaultLimits.
+type Limits struct {
+	// Largest single buffer: a block, the block info, serialized file
+	// metadata, object or streamed data.
+	MaxAllocation int64
+
+	// Most entries in one list: blocks, nodes, objects, types, type tree
+	// nodes, script types and external references.
+	MaxNodeCount int64
+
+	// Largest total uncompressed size of a bundle or a compressed file.
+	MaxDecompressedSize int64
+}
+
+// Limits of bundles opened without Options.Limits and of standalone assets
+var DefaultLimits = Limits{
+	MaxAllocation:       1 << 30,
+	MaxNodeCount:        1 << 22,
+	MaxDecompressedSize: 1 << 35,
+}
+
+// Deepest type tree, as node depths are stored in a byte
+const maxTypeTreeDepth = 255
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxAllocation <= 0 {
+		l.MaxAllocation = DefaultLimits.MaxAllocation
+	}
+	if l.MaxNodeCount <= 0 {
+		l.MaxNodeCount = DefaultLimits.MaxNodeCount
+	}
+	if l.MaxDecompressedSize <= 0 {
+		l.MaxDecompressedSize = DefaultLimits.MaxDecompressedSize
+	}
+	return l
+}
+
+func (l Limits) checkAllocation(what string, size int64) error {
+	if size < 0 {
+		return fmt.Errorf("Invalid %v size: %v", what, size)
+	}
+	if size > l.MaxAllocation {
+		return fmt.Errorf("%w: %v size %v above %v", ErrLimitExceeded, what, size, l.MaxAllocation)
+	}
+	return nil
+}
+
+func (l Limits) checkCount(what string, count int64) error {
+	if count < 0 {
+		return fmt.Errorf("Invalid %v count: %v", what, count)
+	}
+	if count > l.MaxNodeCount {
+		return fmt.Errorf("%w: %v count %v above %v", ErrLimitExceeded, what, count, l.MaxNodeCount)
+	}
+	return nil
+}
+
+func (l Limits) checkDecompressed(size int64) error {
+	if size > l.MaxDecompressedSize {
+		return fmt.Errorf("%w: Decompressed size %v above %v", ErrLimitExceeded, size, l.MaxDecompressedSize)
+	}
+	return nil
+}
+
+// Reads r to the end into memory, failing once more than the allocation
+// and decompression limits were read.
+func (l Limits) readAll(r io.Reader) ([]byte, error) {
+	max := l.MaxAllocation
+	if l.MaxDecompressedSize < max {
+		max = l.MaxDecompressedSize
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%w: Decompressed data above %v bytes", ErrLimitExceeded, max)
+	}
+	return data, nil
+}
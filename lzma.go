@@ -3,7 +3,7 @@ package unity
 import (
 	"bytes"
 	"encoding/binary"
-	"io/ioutil"
+	"errors"
 
 	"github.com/itchio/lzma"
 )
@@ -13,8 +13,70 @@ import (
 // dictSize 		4
 // uncompressedSize 8
 func DecompressLZMARaw(data []byte, uncompressedSize int32) ([]byte, error) {
-	b := make([]byte, 8)
-	binary.LittleEndian.PutUint64(b, uint64(uncompressedSize))
-	data = append(data[:5], append(b, data[5:]...)...)
-	return ioutil.ReadAll(lzma.NewReader(bytes.NewBuffer(data)))
+	return decompressLZMARaw(data, uncompressedSize, DefaultLimits.withDefaults())
+}
+
+func decompressLZMARaw(data []byte, uncompressedSize int32, limits Limits) ([]byte, error) {
+	if len(data) < 5 {
+		return nil, errors.New("unity.DecompressLZMARaw: Invalid LZMA header")
+	}
+	stream := make([]byte, 0, len(data)+8)
+	stream = append(stream, data[:5]...)
+	stream = binary.LittleEndian.AppendUint64(stream, uint64(uncompressedSize))
+	stream = append(stream, data[5:]...)
+	return decompressLZMA(stream, limits)
+}
+
+// Decompresses an LZMA stream that carries its own 13 byte header
+// (props, dictSize and uncompressedSize), as used by UnityWeb.
+func DecompressLZMA(data []byte) ([]byte, error) {
+	return decompressLZMA(data, DefaultLimits.withDefaults())
+}
+
+// The decoder allocates the dictionary up front, so its size is limited, and
+// shrunk to the uncompressed size when that is known.
+func decompressLZMA(data []byte, limits Limits) ([]byte, error) {
+	if len(data) < 13 {
+		return nil, errors.New("unity.DecompressLZMA: Invalid LZMA header")
+	}
+
+	dictSize := int64(binary.LittleEndian.Uint32(data[1:]))
+	size := int64(binary.LittleEndian.Uint64(data[5:]))
+	if size >= 0 && size < dictSize {
+		dictSize = size
+		if dictSize < minLZMADictSize {
+			dictSize = minLZMADictSize
+		}
+		header := make([]byte, 13, len(data))
+		copy(header, data)
+		binary.LittleEndian.PutUint32(header[1:], uint32(dictSize))
+		data = append(header, data[13:]...)
+	}
+	if err := limits.checkAllocation("LZMA dictionary", dictSize); err != nil {
+		return nil, err
+	}
+
+	return limits.readAll(lzma.NewReader(bytes.NewReader(data)))
+}
+
+// Smallest dictionary LZMA encoders write
+const minLZMADictSize = 1 << 12
+
+// Compresses data into the raw LZMA layout used by UnityFS blocks: props and
+// dictSize, without the uncompressed size.
+func CompressLZMARaw(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := lzma.NewWriterSizeLevel(buf, int64(len(data)), lzma.BestCompression)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	compressed := buf.Bytes()
+	if len(compressed) < 13 {
+		return nil, errors.New("unity.CompressLZMARaw: Invalid LZMA header")
+	}
+	return append(compressed[:5:5], compressed[13:]...), nil
 }
@@ -0,0 +1,115 @@
+package unity
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+var errMmapUnsupported = errors.New("memory mapping is not supported on this platform")
+
+// MappedFile is a copy-on-write memory mapping of a file. Reads of object
+// data from a mapped file, or from uncompressed bundles in it, return slices
+// of the mapping instead of copies. Such slices are only valid until Close.
+type MappedFile struct {
+	data []byte
+}
+
+// Maps the file at path into memory.
+func OpenMappedFile(path string) (*MappedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() == 0 {
+		return &MappedFile{}, nil
+	}
+	if int64(int(fi.Size())) != fi.Size() {
+		return nil, fmt.Errorf("unity.OpenMappedFile: File too large to map: %v", fi.Size())
+	}
+
+	data, err := mmap(f, int(fi.Size()))
+	if err != nil {
+		return nil, err
+	}
+	return &MappedFile{data}, nil
+}
+
+// Returns the mapped file contents.
+func (m *MappedFile) Bytes() []byte {
+	return m.data
+}
+
+func (m *MappedFile) Len() int64 {
+	return int64(len(m.data))
+}
+
+func (m *MappedFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("unity.MappedFile.ReadAt: invalid offset (%v)", off)
+	}
+	if off >= m.Len() {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m *MappedFile) slice(off, n int64) ([]byte, error) {
+	return sliceBytes(m.data, off, n)
+}
+
+// Unmaps the file. Slices returned before must not be used afterwards.
+func (m *MappedFile) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	data := m.data
+	m.data = nil
+	return munmap(data)
+}
+
+// Data sources held in memory, whose reads are served by slicing
+type memorySource interface {
+	io.ReaderAt
+	slice(off, n int64) ([]byte, error)
+}
+
+func sliceBytes(b []byte, off, n int64) ([]byte, error) {
+	if off < 0 || n < 0 || off+n > int64(len(b)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b[off : off+n : off+n], nil
+}
+
+// Opens the file at path mapped into memory where supported, and as a plain
+// file otherwise.
+func openFileMapped(path string) (readerAtCloser, int64, error) {
+	m, err := OpenMappedFile(path)
+	if err == nil {
+		return m, m.Len(), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+
+	return f, fi.Size(), nil
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package unity
+
+import (
+	"os"
+	"syscall"
+)
+
+// Private writable mappings let callers modify returned object data without
+// changing the file; pages are only copied when written.
+func mmap(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+}
+
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
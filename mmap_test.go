@@ -0,0 +1,178 @@
+package unity
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+	"unsafe"
+)
+
+// Reports whether b points into the memory of mapping.
+func sameMemory(b, mapping []byte) bool {
+	if len(b) == 0 || len(mapping) == 0 {
+		return false
+	}
+	p := uintptr(unsafe.Pointer(&b[0]))
+	start := uintptr(unsafe.Pointer(&mapping[0]))
+	return p >= start && p < start+uintptr(len(mapping))
+}
+
+func writeTempFile(t *testing.T, data []byte) string {
+	f, err := ioutil.TempFile("", "unity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestMappedFile(t *testing.T) {
+	serialized := readTestSerializedFile(t, "test/main_dxt1_bc1.unity3d")
+	path := writeTempFile(t, serialized)
+	defer os.Remove(path)
+
+	m, err := OpenMappedFile(path)
+	if runtime.GOOS != "linux" {
+		if err == nil {
+			t.Error("Expected an error without memory mapping support")
+		}
+		return
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(m.Bytes(), serialized) {
+		t.Error("Mapped data mismatch")
+	}
+	if err = m.Close(); err != nil || m.Bytes() != nil {
+		t.Errorf("Mapping not released: %v", err)
+	}
+
+	// Objects of standalone assets are slices of the mapping
+	asset, err := OpenAssetFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapped, ok := asset.closer.(*MappedFile)
+	if !ok {
+		t.Fatalf("Asset file not mapped: %T", asset.closer)
+	}
+	for _, pathID := range asset.PathIDs {
+		obj := asset.Objects[pathID]
+		data, err := asset.ObjectData(pathID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := asset.DataOffset + obj.DataOffset
+		if !bytes.Equal(data, serialized[start:start+int64(obj.Size)]) {
+			t.Errorf("Object %v data mismatch", pathID)
+		}
+		if obj.Size > 0 && !sameMemory(data, mapped.Bytes()) {
+			t.Errorf("Object %v data copied", pathID)
+		}
+	}
+
+	// Changing returned data leaves the file unchanged
+	data, _ := asset.ObjectData(asset.PathIDs[0])
+	data[0] ^= 0xff
+	if err = asset.Close(); err != nil || mapped.Bytes() != nil {
+		t.Errorf("Asset mapping not released: %v", err)
+	}
+	if onDisk, _ := ioutil.ReadFile(path); !bytes.Equal(onDisk, serialized) {
+		t.Error("File changed through the mapping")
+	}
+
+	// AssetFromFile maps the file until Close, also when loading fails
+	if asset, err = AssetFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if !isMapped(t, path) {
+		t.Error("AssetFromFile didn't map the file")
+	}
+	if err = asset.Close(); err != nil || isMapped(t, path) {
+		t.Errorf("AssetFromFile mapping not released: %v", err)
+	}
+
+	corruptPath := writeTempFile(t, serialized[:100])
+	defer os.Remove(corruptPath)
+	if _, err = AssetFromFile(corruptPath); err == nil {
+		t.Error("Expected an error for a truncated file")
+	}
+	if isMapped(t, corruptPath) {
+		t.Error("Mapping of a file that failed to load not released")
+	}
+
+	// NewReaderFromFilePath keeps reading into memory
+	reader, err := NewReaderFromFilePath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.mapped != nil || isMapped(t, path) {
+		t.Error("NewReaderFromFilePath mapped the file")
+	}
+
+	// Uncompressed bundles
+	nodes := []BundleNode{{Name: "CAB-test", Status: NodeStatusSerializedFile, Size: int64(len(serialized)), Data: bytes.NewReader(serialized)}}
+	buf := &bytes.Buffer{}
+	if err := WriteBundle(buf, nodes, &WriteOptions{Compression: CompressionNone}); err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := writeTempFile(t, buf.Bytes())
+	defer os.Remove(bundlePath)
+
+	for _, open := range []func(string) (*Bundle, error){
+		ReadBundle,
+		func(path string) (*Bundle, error) { return OpenBundleFile(path, nil) },
+	} {
+		bundle, err := open(bundlePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = bundle.ResolveAsset(0); err != nil {
+			t.Fatal(err)
+		}
+
+		var mapping []byte
+		switch closer := bundle.closer.(type) {
+		case *MappedFile:
+			mapping = closer.Bytes()
+		case *Reader:
+			mapping = closer.buf
+		default:
+			t.Fatalf("Bundle file not mapped: %T", bundle.closer)
+		}
+
+		asset := bundle.Assets[0]
+		for _, pathID := range asset.PathIDs {
+			obj := asset.Objects[pathID]
+			data, err := asset.ObjectData(pathID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := asset.DataOffset + obj.DataOffset
+			if !bytes.Equal(data, serialized[start:start+int64(obj.Size)]) {
+				t.Errorf("Bundle object %v data mismatch", pathID)
+			}
+			if obj.Size > 0 && !sameMemory(data, mapping) {
+				t.Errorf("Bundle object %v data copied", pathID)
+			}
+		}
+
+		if err = bundle.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// Reports whether the file at path is mapped into the process.
+func isMapped(t *testing.T, path string) bool {
+	maps, err := ioutil.ReadFile("/proc/self/maps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Contains(maps, []byte(path))
+}
@@ -5,15 +5,15 @@ import (
 )
 
 type ObjectInfo struct {
-	PathID     int64
-	DataOffset uint32
-	Size       uint32
-	TypeID     int32
-	ClassID    int16
-	// Not needed
-	// IsDestroyed bool  `version:"<11"`
-	// Unknown0    int16 `version:">=11"`
-	// Unknown1    byte  `version:">=15"`
+	PathID          int64
+	DataOffset      int64
+	Size            uint32
+	TypeID          int32
+	ClassID         int16
+	TypeIndex       int32  // Index into the metadata types, format >= 16
+	IsDestroyed     uint16 // Format < 11
+	ScriptTypeIndex int16  // Format 11 to 16
+	Stripped        uint8  // Format 15 and 16
 }
 
 func ReadObjectInfo(asset *Asset, reader *Reader) (obj *ObjectInfo, err error) {
@@ -22,15 +22,23 @@ func ReadObjectInfo(asset *Asset, reader *Reader) (obj *ObjectInfo, err error) {
 		return
 	}
 
-	if obj.DataOffset, err = reader.Uint32(); err != nil {
-		return
+	if asset.Format >= 22 {
+		if obj.DataOffset, err = reader.Int64(); err != nil {
+			return
+		}
+	} else {
+		dataOffset, err := reader.Uint32()
+		if err != nil {
+			return nil, err
+		}
+		obj.DataOffset = int64(dataOffset)
 	}
 
 	if obj.Size, err = reader.Uint32(); err != nil {
 		return
 	}
 
-	if asset.Format < 17 {
+	if asset.Format < 16 {
 		if obj.TypeID, err = reader.Int32(); err != nil {
 			return
 		}
@@ -39,26 +47,28 @@ func ReadObjectInfo(asset *Asset, reader *Reader) (obj *ObjectInfo, err error) {
 			return
 		}
 	} else {
-		typeIndex, _ := reader.Int32()
-		if len(asset.Tree.ClassIDs) <= int(typeIndex) {
-			return nil, fmt.Errorf("unity.ReadObjectInfo: Undefined type metadata. TypeIndex: %v", typeIndex)
+		if obj.TypeIndex, err = reader.Int32(); err != nil {
+			return
 		}
-		classID := asset.Tree.ClassIDs[typeIndex]
+		if obj.TypeIndex < 0 || len(asset.Tree.ClassIDs) <= int(obj.TypeIndex) {
+			return nil, fmt.Errorf("unity.ReadObjectInfo: Undefined type metadata. TypeIndex: %v", obj.TypeIndex)
+		}
+		classID := asset.Tree.ClassIDs[obj.TypeIndex]
 		obj.TypeID = classID
 		obj.ClassID = int16(classID)
 	}
 
 	if asset.Format < 11 {
-		if _, err = reader.Int16(); err != nil {
+		if obj.IsDestroyed, err = reader.Uint16(); err != nil {
 			return
 		}
 	} else if asset.Format >= 11 && asset.Format < 17 {
-		if _, err = reader.Int16(); err != nil {
+		if obj.ScriptTypeIndex, err = reader.Int16(); err != nil {
 			return
 		}
 
 		if asset.Format >= 15 {
-			if _, err = reader.Int8(); err != nil {
+			if obj.Stripped, err = reader.Uint8(); err != nil {
 				return
 			}
 		}
@@ -77,3 +87,36 @@ func (oi *ObjectInfo) readID(asset *Asset, reader *Reader) (int64, error) {
 	}
 	return asset.ReadID(reader)
 }
+
+func (oi *ObjectInfo) write(asset *Asset, w *Writer) {
+	if asset.LongObjectIDs || asset.Format >= 14 {
+		w.Int64(oi.PathID)
+	} else {
+		w.Int32(int32(oi.PathID))
+	}
+
+	if asset.Format >= 22 {
+		w.Int64(oi.DataOffset)
+	} else {
+		w.Uint32(uint32(oi.DataOffset))
+	}
+
+	w.Uint32(oi.Size)
+
+	if asset.Format < 16 {
+		w.Int32(oi.TypeID)
+		w.Int16(oi.ClassID)
+	} else {
+		w.Int32(oi.TypeIndex)
+	}
+
+	if asset.Format < 11 {
+		w.Uint16(oi.IsDestroyed)
+	} else if asset.Format < 17 {
+		w.Int16(oi.ScriptTypeIndex)
+
+		if asset.Format >= 15 {
+			w.Uint8(oi.Stripped)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package unity
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kinds of Unity content found in a package
+const (
+	PackageEntryBundle = iota
+	PackageEntrySerializedFile
+)
+
+// A bundle or serialized file inside an APK, OBB, IPA or ZIP package.
+type PackageEntry struct {
+	Name  string // Path in the package, without .splitN for split files
+	Kind  int
+	Size  int64
+	Parts []string // Paths of the .splitN parts of split files
+
+	pkg   *Package
+	files []*zip.File
+}
+
+// Package finds Unity content inside a zip based package by the signatures
+// of its entries. Entries are read in place and opened on demand.
+type Package struct {
+	Entries []*PackageEntry
+
+	source io.ReaderAt
+	zip    *zip.Reader
+	closer io.Closer
+}
+
+// Opens the package at path, keeping the file open until Close.
+func OpenPackageFile(path string) (*Package, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	pkg, err := OpenPackage(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	pkg.closer = f
+	return pkg, nil
+}
+
+// Scans the zip entries of a package of size bytes from r.
+func OpenPackage(r io.ReaderAt, size int64) (*Package, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &Package{
+		source: r,
+		zip:    zr,
+	}
+
+	splits := map[string][]*zip.File{}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		if base, isPart := splitBase(f.Name); isPart {
+			splits[base] = append(splits[base], f)
+			continue
+		}
+
+		entry := &PackageEntry{
+			Name:  f.Name,
+			Size:  int64(f.UncompressedSize64),
+			pkg:   pkg,
+			files: []*zip.File{f},
+		}
+		if pkg.detect(entry) {
+			pkg.Entries = append(pkg.Entries, entry)
+		}
+	}
+
+	for base, files := range splits {
+		sort.Slice(files, func(i, j int) bool {
+			return splitIndex(files[i].Name) < splitIndex(files[j].Name)
+		})
+
+		entry := &PackageEntry{
+			Name:  base,
+			pkg:   pkg,
+			files: files,
+		}
+		for i, f := range files {
+			if splitIndex(f.Name) != i {
+				entry = nil
+				break
+			}
+			entry.Parts = append(entry.Parts, f.Name)
+			entry.Size += int64(f.UncompressedSize64)
+		}
+
+		if entry != nil && pkg.detect(entry) {
+			pkg.Entries = append(pkg.Entries, entry)
+		}
+	}
+
+	sort.Slice(pkg.Entries, func(i, j int) bool {
+		return pkg.Entries[i].Name < pkg.Entries[j].Name
+	})
+
+	return pkg, nil
+}
+
+// Returns N of a part named *.splitN.
+func splitIndex(name string) int {
+	i, err := strconv.Atoi(name[strings.LastIndex(name, splitSuffix)+len(splitSuffix):])
+	if err != nil {
+		return -1
+	}
+	return i
+}
+
+// Sets the kind of entry from the start of its data, and reports whether it
+// is Unity content.
+func (pkg *Package) detect(entry *PackageEntry) bool {
+	f := entry.files[0]
+	rc, err := f.Open()
+	if err != nil {
+		return false
+	}
+	defer rc.Close()
+
+	header := make([]byte, 48)
+	n, _ := io.ReadFull(rc, header)
+	header = header[:n]
+
+	for _, sig := range []string{SignatureFS, SignatureWeb, SignatureRaw, SignatureArchive, SignatureWebData} {
+		if bytes.HasPrefix(header, []byte(sig+"\x00")) {
+			entry.Kind = PackageEntryBundle
+			return true
+		}
+	}
+
+	if IsSerializedFile(header, entry.Size) {
+		entry.Kind = PackageEntrySerializedFile
+		return true
+	}
+
+	return false
+}
+
+// Returns the entry data. Stored entries are read in place; compressed
+// ones are decompressed into memory within limits.
+func (entry *PackageEntry) open(limits Limits) (io.ReaderAt, error) {
+	readers := make([]io.ReaderAt, len(entry.files))
+	sizes := make([]int64, len(entry.files))
+	for i, f := range entry.files {
+		sizes[i] = int64(f.UncompressedSize64)
+
+		if f.Method == zip.Store {
+			offset, err := f.DataOffset()
+			if err != nil {
+				return nil, err
+			}
+			readers[i] = io.NewSectionReader(entry.pkg.source, offset, sizes[i])
+			continue
+		}
+
+		if err := limits.checkAllocation(f.Name, sizes[i]); err != nil {
+			return nil, err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := limits.readAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		readers[i] = bytes.NewReader(data)
+	}
+
+	if len(readers) == 1 {
+		return readers[0], nil
+	}
+	return NewMultiReaderAt(readers, sizes), nil
+}
+
+// Opens a bundle entry.
+func (entry *PackageEntry) OpenBundle(opts *Options) (*Bundle, error) {
+	if entry.Kind != PackageEntryBundle {
+		return nil, fmt.Errorf("unity.PackageEntry.OpenBundle: %v is not a bundle", entry.Name)
+	}
+
+	limits := DefaultLimits
+	if opts != nil {
+		limits = opts.Limits
+	}
+	r, err := entry.open(limits.withDefaults())
+	if err != nil {
+		return nil, err
+	}
+	return OpenBundle(r, entry.Size, opts)
+}
+
+// Opens a serialized file entry.
+func (entry *PackageEntry) OpenAsset() (*Asset, error) {
+	if entry.Kind != PackageEntrySerializedFile {
+		return nil, fmt.Errorf("unity.PackageEntry.OpenAsset: %v is not a serialized file", entry.Name)
+	}
+
+	r, err := entry.open(DefaultLimits.withDefaults())
+	if err != nil {
+		return nil, err
+	}
+	return OpenAsset(r, entry.Size, path.Base(entry.Name))
+}
+
+// Closes the package file if it was opened by OpenPackageFile. Bundles and
+// assets opened from its entries can't read data afterwards.
+func (pkg *Package) Close() error {
+	if pkg.closer == nil {
+		return nil
+	}
+	err := pkg.closer.Close()
+	pkg.closer = nil
+	return err
+}
@@ -0,0 +1,91 @@
+package unity
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestPackage(t *testing.T) {
+	bundleData, err := ioutil.ReadFile("test/main_dxt1_bc1.unity3d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assetData := readTestSerializedFile(t, "test/20147_cs_h")
+
+	files := []struct {
+		name   string
+		data   []byte
+		method uint16
+	}{
+		{"assets/bin/Data/data.unity3d", bundleData, zip.Store},
+		{"assets/bin/Data/sharedassets0.assets", assetData, zip.Deflate},
+		{"assets/bin/Data/level0.split1", assetData[1000:], zip.Store},
+		{"assets/bin/Data/level0.split0", assetData[:1000], zip.Deflate},
+		{"classes.dex", []byte("dex\n035\x00"), zip.Deflate},
+	}
+
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: f.method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(f.data)
+	}
+	zw.Close()
+
+	pkg, err := OpenPackage(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pkg.Close()
+
+	expected := []struct {
+		name string
+		kind int
+	}{
+		{"assets/bin/Data/data.unity3d", PackageEntryBundle},
+		{"assets/bin/Data/level0", PackageEntrySerializedFile},
+		{"assets/bin/Data/sharedassets0.assets", PackageEntrySerializedFile},
+	}
+
+	if len(pkg.Entries) != len(expected) {
+		t.Fatalf("Invalid entry count. Got: %v Expected: %v", len(pkg.Entries), len(expected))
+	}
+
+	for i, entry := range pkg.Entries {
+		if entry.Name != expected[i].name || entry.Kind != expected[i].kind {
+			t.Errorf("Invalid entry. Got: %v (%v) Expected: %v (%v)", entry.Name, entry.Kind, expected[i].name, expected[i].kind)
+			continue
+		}
+
+		if entry.Kind == PackageEntryBundle {
+			bundle, err := entry.OpenBundle(nil)
+			if err != nil {
+				t.Error(err)
+			} else if err = bundle.ResolveAsset(0); err != nil {
+				t.Error(err)
+			} else if len(bundle.Assets[0].Objects) != 4 {
+				t.Errorf("%v: Invalid object count. Got: %v Expected: 4", entry.Name, len(bundle.Assets[0].Objects))
+			}
+			continue
+		}
+
+		asset, err := entry.OpenAsset()
+		if err != nil {
+			t.Errorf("%v: %v", entry.Name, err)
+			continue
+		}
+		if len(asset.Objects) != 2 {
+			t.Errorf("%v: Invalid object count. Got: %v Expected: 2", entry.Name, len(asset.Objects))
+		}
+		for pathID := range asset.Objects {
+			if _, err = asset.ObjectData(pathID); err != nil {
+				t.Errorf("%v: %v", entry.Name, err)
+			}
+		}
+	}
+}
@@ -11,10 +11,11 @@ type Reader struct {
 	buf    []byte
 	off    int64
 	endian binary.ByteOrder
+	mapped *MappedFile
 }
 
 func NewReader(b []byte) (*Reader, error) {
-	return &Reader{b, 0, binary.BigEndian}, nil
+	return &Reader{buf: b, endian: binary.BigEndian}, nil
 }
 
 func NewReaderFromFilePath(path string) (*Reader, error) {
@@ -22,7 +23,29 @@ func NewReaderFromFilePath(path string) (*Reader, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Reader{b, 0, binary.BigEndian}, nil
+	return &Reader{buf: b, endian: binary.BigEndian}, nil
+}
+
+// Maps the file at path into memory where supported, and reads it otherwise.
+// The mapping is kept until Close.
+func NewMappedReader(path string) (*Reader, error) {
+	if m, err := OpenMappedFile(path); err == nil {
+		return &Reader{buf: m.Bytes(), endian: binary.BigEndian, mapped: m}, nil
+	}
+	return NewReaderFromFilePath(path)
+}
+
+// Releases the data of the Reader, unmapping it if it is from
+// NewMappedReader. Slices read before must not be used afterwards.
+func (r *Reader) Close() error {
+	r.buf = nil
+	r.off = 0
+	if r.mapped == nil {
+		return nil
+	}
+	err := r.mapped.Close()
+	r.mapped = nil
+	return err
 }
 
 func (r *Reader) ChangeEndian(isLittleEndian bool) {
@@ -75,8 +98,13 @@ func (r *Reader) Remaining() int64 {
 }
 
 func (r *Reader) Align() (int64, error) {
+	return r.AlignTo(4)
+}
+
+// Aligns the offset to a multiple of n, which must be a power of two
+func (r *Reader) AlignTo(n int64) (int64, error) {
 	old := r.Tell()
-	new := (old + 3) & -4
+	new := (old + n - 1) & -n
 	if new > old {
 		return r.SeekStart(new)
 	}
@@ -254,3 +282,22 @@ func (r *Reader) StringPrefixed() (string, error) {
 
 	return r.StringLimited(int64(len))
 }
+
+// Implements io.ReaderAt over the whole buffer, independent of the offset
+func (r *Reader) slice(off, n int64) ([]byte, error) {
+	return sliceBytes(r.buf, off, n)
+}
+
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("Reader.ReadAt: invalid offset (%v)", off)
+	}
+	if off >= r.Len() {
+		return 0, io.EOF
+	}
+	n := copy(p, r.buf[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
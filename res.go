@@ -1,15 +1,104 @@
 package unity
 
 import (
-	"io/ioutil"
-	"log"
+	"embed"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+// Common strings of type trees, one table for every Unity version that added
+// strings, named after that version. Type tree nodes refer to them by
+// negative offsets. Strings are only appended, so offsets stay valid.
+//
+//go:embed strings/*.dat
+var commonStringsFS embed.FS
+
+type commonStringTable struct {
+	version [3]int // First Unity version using the table
+	data    []byte
+}
+
+// Sorted by version
+var commonStringTables []commonStringTable
+
+// Common strings of the newest Unity version
 var STRINGS_DAT []byte
 
 func init() {
-	var err error
-	if STRINGS_DAT, err = ioutil.ReadFile("strings.dat"); err != nil {
-		log.Fatal(err)
+	entries, err := commonStringsFS.ReadDir("strings")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, entry := range entries {
+		version, ok := parseUnityVersion(strings.TrimSuffix(entry.Name(), ".dat"))
+		if !ok {
+			panic("unity: Invalid common strings table name: " + entry.Name())
+		}
+		data, err := commonStringsFS.ReadFile(path.Join("strings", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		commonStringTables = append(commonStringTables, commonStringTable{version, data})
+	}
+
+	sort.Slice(commonStringTables, func(i, j int) bool {
+		return compareUnityVersions(commonStringTables[i].version, commonStringTables[j].version) < 0
+	})
+	STRINGS_DAT = commonStringTables[len(commonStringTables)-1].data
+}
+
+// Returns the common strings of a Unity version such as "2018.4.2f1". The
+// newest table is used for versions that can't be parsed, as stripped files
+// store "0.0.0".
+func commonStrings(version string) []byte {
+	v, ok := parseUnityVersion(version)
+	if !ok || v == [3]int{} {
+		return STRINGS_DAT
+	}
+
+	data := commonStringTables[0].data
+	for _, table := range commonStringTables {
+		if compareUnityVersions(table.version, v) > 0 {
+			break
+		}
+		data = table.data
+	}
+	return data
+}
+
+// Parses the major, minor and patch numbers of a Unity version, ignoring the
+// release type suffix as in "2019.4.31f1".
+func parseUnityVersion(s string) (v [3]int, ok bool) {
+	parts := strings.SplitN(s, ".", 3)
+	if len(parts) != 3 {
+		return v, false
+	}
+
+	for i, part := range parts {
+		end := 0
+		for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+			end++
+		}
+		n, err := strconv.Atoi(part[:end])
+		if err != nil {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+func compareUnityVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
 	}
+	return 0
 }
@@ -0,0 +1,39 @@
+package unity
+
+import (
+	"testing"
+)
+
+func TestCommonStrings(t *testing.T) {
+	tests := []struct {
+		version string
+		last    string
+	}{
+		{"4.7.2f1", "Vector4f"},
+		{"5.0.0f4", "Vector4f"},
+		{"5.6.7f1", "Gradient"},
+		{"2017.1.5f1", "Type*"},
+		{"2017.4.40f1", "BoundsInt"},
+		{"2018.4.2f1", "m_PrefabAsset"},
+		{"2022.3.10f1", "Hash128"},
+		{"0.0.0", "Hash128"},
+		{"unknown", "Hash128"},
+	}
+
+	for _, test := range tests {
+		table := commonStrings(test.version)
+		if last := strFromBuf(0, nil, table, int32(len(table)-len(test.last)-1)|-0x80000000); last != test.last {
+			t.Errorf("%v: Invalid last common string. Got: %q Expected: %q", test.version, last, test.last)
+		}
+	}
+
+	// Offsets are the same in every table, and past the end for older ones
+	for _, version := range []string{"5.0.0", "2019.1.0"} {
+		if name := strFromBuf(0, nil, commonStrings(version), 427|-0x80000000); name != "m_Name" {
+			t.Errorf("%v: Invalid common string at 427: %q", version, name)
+		}
+	}
+	if s := strFromBuf(0, nil, commonStrings("2018.2.0"), 1161|-0x80000000); s != "" {
+		t.Errorf("Expected no common string past the end of the table. Got: %q", s)
+	}
+}
@@ -0,0 +1,160 @@
+package unity
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const splitSuffix = ".split"
+
+// MultiReaderAt joins several sources into one io.ReaderAt without copying
+// them, as used for files split into .split0 … .splitN parts.
+type MultiReaderAt struct {
+	readers []io.ReaderAt
+	offsets []int64
+	size    int64
+}
+
+func NewMultiReaderAt(readers []io.ReaderAt, sizes []int64) *MultiReaderAt {
+	m := &MultiReaderAt{
+		readers: readers,
+		offsets: make([]int64, len(readers)),
+	}
+	for i, size := range sizes {
+		m.offsets[i] = m.size
+		m.size += size
+	}
+	return m
+}
+
+func (m *MultiReaderAt) Size() int64 {
+	return m.size
+}
+
+func (m *MultiReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("unity.MultiReaderAt.ReadAt: invalid offset (%v)", off)
+	}
+
+	// Index of the last part starting at or before off
+	i := sort.Search(len(m.offsets), func(i int) bool { return m.offsets[i] > off }) - 1
+	for n < len(p) && i >= 0 && i < len(m.readers) {
+		pos := off + int64(n)
+		end := m.size
+		if i+1 < len(m.offsets) {
+			end = m.offsets[i+1]
+		}
+		if pos >= end {
+			i++
+			continue
+		}
+
+		want := p[n:]
+		if int64(len(want)) > end-pos {
+			want = want[:end-pos]
+		}
+		read, err := m.readers[i].ReadAt(want, pos-m.offsets[i])
+		n += read
+		if read < len(want) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+		i++
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Closes every part that implements io.Closer.
+func (m *MultiReaderAt) Close() (err error) {
+	for _, r := range m.readers {
+		if closer, ok := r.(io.Closer); ok {
+			if cerr := closer.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+	}
+	return err
+}
+
+// Returns the base path of a split set and whether path names one of its
+// parts.
+func splitBase(path string) (string, bool) {
+	i := strings.LastIndex(path, splitSuffix)
+	if i < 0 || i+len(splitSuffix) == len(path) {
+		return path, false
+	}
+	for _, c := range path[i+len(splitSuffix):] {
+		if c < '0' || c > '9' {
+			return path, false
+		}
+	}
+	return path[:i], true
+}
+
+// Returns the parts of the split file at path in order, or nil if there is
+// none. Path may name the joined file or any of its parts.
+func SplitFiles(path string) []string {
+	base, _ := splitBase(path)
+
+	parts := []string{}
+	for i := 0; ; i++ {
+		part := fmt.Sprintf("%s%s%d", base, splitSuffix, i)
+		if _, err := os.Stat(part); err != nil {
+			break
+		}
+		parts = append(parts, part)
+	}
+
+	if len(parts) == 0 {
+		return nil
+	}
+	return parts
+}
+
+// Opens and joins the parts of the split file at path.
+func OpenSplitFile(path string) (*MultiReaderAt, error) {
+	parts := SplitFiles(path)
+	if parts == nil {
+		return nil, fmt.Errorf("unity.OpenSplitFile: No split parts for %v", path)
+	}
+
+	readers := make([]io.ReaderAt, 0, len(parts))
+	sizes := make([]int64, 0, len(parts))
+	for _, part := range parts {
+		f, err := os.Open(part)
+		if err == nil {
+			var fi os.FileInfo
+			if fi, err = f.Stat(); err == nil {
+				readers = append(readers, f)
+				sizes = append(sizes, fi.Size())
+				continue
+			}
+			f.Close()
+		}
+		NewMultiReaderAt(readers, sizes).Close()
+		return nil, err
+	}
+
+	return NewMultiReaderAt(readers, sizes), nil
+}
+
+// Reports whether path should be read from split parts: it names a part, or
+// it doesn't exist and parts are found next to it.
+func isSplitFile(path string) bool {
+	if _, isPart := splitBase(path); isPart {
+		return SplitFiles(path) != nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		return false
+	}
+	return SplitFiles(path) != nil
+}
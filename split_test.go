@@ -0,0 +1,82 @@
+package unity
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes data as path.split0 … path.splitN parts of at most partSize bytes.
+func writeSplitFile(t *testing.T, path string, data []byte, partSize int) {
+	for i := 0; i*partSize < len(data); i++ {
+		end := (i + 1) * partSize
+		if end > len(data) {
+			end = len(data)
+		}
+		part := fmt.Sprintf("%s.split%d", path, i)
+		if err := ioutil.WriteFile(part, data[i*partSize:end], 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSplitFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bundleData, err := ioutil.ReadFile("test/main_dxt1_bc1.unity3d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(dir, "data.unity3d")
+	writeSplitFile(t, bundlePath, bundleData, 100000)
+
+	for _, path := range []string{bundlePath, bundlePath + ".split0", bundlePath + ".split3"} {
+		bundle, err := ReadBundle(path)
+		if err != nil {
+			t.Errorf("%v: %v", path, err)
+			continue
+		}
+		if err = bundle.ResolveAsset(0); err != nil {
+			t.Errorf("%v: %v", path, err)
+		} else if len(bundle.Assets[0].Objects) != 4 {
+			t.Errorf("%v: Invalid object count. Got: %v Expected: 4", path, len(bundle.Assets[0].Objects))
+		}
+		bundle.Close()
+	}
+
+	assetData := readTestSerializedFile(t, "test/main_dxt1_bc1.unity3d")
+	assetPath := filepath.Join(dir, "sharedassets0.assets")
+	writeSplitFile(t, assetPath, assetData, 1000)
+
+	asset, err := AssetFromFile(assetPath + ".split0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer asset.Close()
+
+	if asset.Name != "sharedassets0.assets" || asset.Path != assetPath {
+		t.Errorf("Invalid asset name or path. Got: %v, %v", asset.Name, asset.Path)
+	}
+
+	for pathID, obj := range asset.Objects {
+		data, err := asset.ObjectData(pathID)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		start := asset.DataOffset + int64(obj.DataOffset)
+		if string(data) != string(assetData[start:start+int64(obj.Size)]) {
+			t.Errorf("Object %v data mismatch", pathID)
+		}
+	}
+
+	if parts := SplitFiles(filepath.Join(dir, "missing")); parts != nil {
+		t.Errorf("Expected no parts. Got: %v", parts)
+	}
+}
@@ -0,0 +1,113 @@
+package unity
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/zklm/unity/engine"
+)
+
+const archivePrefix = "archive:/"
+
+// Returns the index of the node named by path, which is either a node name
+// or an archive:/ path to it, or -1 if there is none.
+func (bundle *Bundle) FindNode(nodePath string) int {
+	nodePath = strings.TrimPrefix(nodePath, archivePrefix)
+	for i, node := range bundle.Nodes {
+		if node.Name == nodePath {
+			return i
+		}
+	}
+
+	base := path.Base(nodePath)
+	for i, node := range bundle.Nodes {
+		if path.Base(node.Name) == base {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Returns size bytes at offset of the streamed data file at path. The file
+// is looked up among the nodes of the asset's bundle and, for standalone
+// files, next to the asset on disk.
+func (a *Asset) ReadStreamed(streamPath string, offset, size int64) ([]byte, error) {
+	if streamPath == "" {
+		return nil, errors.New("unity.Asset.ReadStreamed: No streamed data path")
+	}
+	if offset < 0 || size < 0 {
+		return nil, fmt.Errorf("unity.Asset.ReadStreamed: Invalid range %v+%v", offset, size)
+	}
+
+	if a.Bundle != nil {
+		if i := a.Bundle.FindNode(streamPath); i >= 0 {
+			section, err := a.Bundle.OpenNode(i)
+			if err != nil {
+				return nil, err
+			}
+			return readStreamedRange(section, section.Size(), offset, size, a.limits())
+		}
+	}
+
+	if a.Path != "" {
+		dir := filepath.Dir(a.Path)
+		rel := filepath.FromSlash(strings.TrimPrefix(streamPath, archivePrefix))
+		for _, candidate := range []string{filepath.Join(dir, rel), filepath.Join(dir, filepath.Base(rel))} {
+			// The path comes from the file, so it may not leave its directory
+			if !isInDir(dir, candidate) {
+				continue
+			}
+			r, fileSize, err := openFile(candidate)
+			if err != nil {
+				continue
+			}
+			data, err := readStreamedRange(r, fileSize, offset, size, a.limits())
+			r.Close()
+			return data, err
+		}
+	}
+
+	return nil, fmt.Errorf("unity.Asset.ReadStreamed: Streamed data file not found: %v", streamPath)
+}
+
+// Returns the texture or mesh data referenced by info.
+func (a *Asset) ReadStreamingInfo(info engine.StreamingInfo) ([]byte, error) {
+	return a.ReadStreamed(info.Path, int64(info.Offset), int64(info.Size))
+}
+
+// Returns the audio or video data referenced by res.
+func (a *Asset) ReadStreamedResource(res engine.StreamedResource) ([]byte, error) {
+	return a.ReadStreamed(res.Source, int64(res.Offset), int64(res.Size))
+}
+
+// Reports whether path is a file below dir.
+func isInDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || rel == ".." {
+		return false
+	}
+	return !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func readStreamedRange(r io.ReaderAt, fileSize, offset, size int64, limits Limits) ([]byte, error) {
+	if offset < 0 || size < 0 || offset+size > fileSize {
+		return nil, fmt.Errorf("unity.Asset.ReadStreamed: Range %v+%v out of bounds (%v)", offset, size, fileSize)
+	}
+
+	if err := limits.checkAllocation("streamed data", size); err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if n, err := r.ReadAt(data, offset); int64(n) < size {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,297 @@
+package unity
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+const (
+	typeDatabaseSignature = "UnityTypeDB"
+	typeDatabaseVersion   = 1
+
+	// Serialized file format whose blob type tree layout the database uses
+	typeDatabaseTreeFormat = 22
+)
+
+// Type database of bundles opened without Options.TypeDatabase and of
+// standalone assets. It is used when files are loaded, so set it before.
+var DefaultTypeDatabase *TypeDatabase
+
+// TypeDatabase holds type trees for files that don't include them. Types are
+// found by their hash, or else by the class ID for the Unity version of the
+// file or the closest older patch release of the same version.
+type TypeDatabase struct {
+	trees   []*TypeTree
+	entries []typeDatabaseEntry
+
+	byHash  map[string]int
+	byClass map[int32][]int // Entry indexes sorted by version
+	byTree  map[string]int  // Tree indexes by serialized tree
+}
+
+type typeDatabaseEntry struct {
+	version string
+	parsed  [3]int
+	classID int32
+	hash    []byte
+	tree    int
+}
+
+func NewTypeDatabase() *TypeDatabase {
+	return &TypeDatabase{
+		byHash:  make(map[string]int),
+		byClass: make(map[int32][]int),
+		byTree:  make(map[string]int),
+	}
+}
+
+// Loads the database written by WriteTo at path.
+func LoadTypeDatabase(path string) (*TypeDatabase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	db, err := ReadTypeDatabase(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return db, nil
+}
+
+// Reads a database written by WriteTo.
+func ReadTypeDatabase(r io.Reader) (*TypeDatabase, error) {
+	limits := DefaultLimits.withDefaults()
+	data, err := limits.readAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, _ := NewReader(data)
+	reader.ChangeEndian(true)
+	fail := func(err error) (*TypeDatabase, error) {
+		return nil, formatError(StageTypeTree, reader.Tell(), err)
+	}
+
+	if signature, err := reader.StringNull(); err != nil {
+		return fail(err)
+	} else if signature != typeDatabaseSignature {
+		return nil, errors.New("unity.ReadTypeDatabase: Not a type database")
+	}
+	if version, err := reader.Uint32(); err != nil {
+		return fail(err)
+	} else if version != typeDatabaseVersion {
+		return nil, fmt.Errorf("unity.ReadTypeDatabase: Unsupported version %v", version)
+	}
+
+	db := NewTypeDatabase()
+	numTrees, err := reader.Uint32()
+	if err == nil {
+		err = limits.checkCount("type", int64(numTrees))
+	}
+	if err != nil {
+		return fail(err)
+	}
+	for i := uint32(0); i < numTrees; i++ {
+		tree, err := readTypeTree(reader, true, typeDatabaseTreeFormat, STRINGS_DAT, limits)
+		if err != nil {
+			return fail(err)
+		}
+		db.trees = append(db.trees, tree)
+	}
+
+	numEntries, err := reader.Uint32()
+	if err == nil {
+		err = limits.checkCount("type", int64(numEntries))
+	}
+	if err != nil {
+		return fail(err)
+	}
+	for i := uint32(0); i < numEntries; i++ {
+		var e typeDatabaseEntry
+		if e.version, err = reader.StringNull(); err != nil {
+			return fail(err)
+		}
+		if e.classID, err = reader.Int32(); err != nil {
+			return fail(err)
+		}
+		hashSize, err := reader.Uint8()
+		if err != nil {
+			return fail(err)
+		}
+		if e.hash, err = reader.Bytes(int64(hashSize)); err != nil {
+			return fail(err)
+		}
+		treeIndex, err := reader.Uint32()
+		if err != nil {
+			return fail(err)
+		}
+		if int(treeIndex) >= len(db.trees) {
+			return fail(fmt.Errorf("Invalid type tree index %v", treeIndex))
+		}
+		e.tree = int(treeIndex)
+		db.addEntry(e)
+	}
+
+	return db, nil
+}
+
+// Writes the database in a compact binary form.
+func (db *TypeDatabase) WriteTo(w io.Writer) (int64, error) {
+	out := NewWriter()
+	out.ChangeEndian(true)
+	out.StringNull(typeDatabaseSignature)
+	out.Uint32(typeDatabaseVersion)
+
+	out.Uint32(uint32(len(db.trees)))
+	for _, tree := range db.trees {
+		writeBlobTypeTree(out, tree, typeDatabaseTreeFormat, STRINGS_DAT)
+	}
+
+	out.Uint32(uint32(len(db.entries)))
+	for _, e := range db.entries {
+		out.StringNull(e.version)
+		out.Int32(e.classID)
+		out.Uint8(uint8(len(e.hash)))
+		out.Write(e.hash)
+		out.Uint32(uint32(e.tree))
+	}
+
+	n, err := w.Write(out.Data())
+	return int64(n), err
+}
+
+// Number of types in the database
+func (db *TypeDatabase) Len() int {
+	return len(db.entries)
+}
+
+// Adds the type tree of a class for a Unity version, replacing an earlier
+// tree of the same version, class and hash. Types with a hash are also found
+// by it.
+func (db *TypeDatabase) Add(version string, classID int32, hash []byte, tree *TypeTree) {
+	if len(hash) > 255 {
+		hash = hash[:255]
+	}
+
+	w := NewWriter()
+	writeBlobTypeTree(w, tree, typeDatabaseTreeFormat, STRINGS_DAT)
+	key := string(w.Data())
+	index, found := db.byTree[key]
+	if !found {
+		index = len(db.trees)
+		db.trees = append(db.trees, tree)
+		db.byTree[key] = index
+	}
+
+	for _, i := range db.byClass[classID] {
+		if e := &db.entries[i]; e.version == version && bytes.Equal(e.hash, hash) {
+			e.tree = index
+			return
+		}
+	}
+	db.addEntry(typeDatabaseEntry{version: version, classID: classID, hash: append([]byte(nil), hash...), tree: index})
+}
+
+func (db *TypeDatabase) addEntry(e typeDatabaseEntry) {
+	e.parsed, _ = parseUnityVersion(e.version)
+	index := len(db.entries)
+	db.entries = append(db.entries, e)
+
+	if len(e.hash) > 0 && !isZero(e.hash) {
+		if _, found := db.byHash[string(e.hash)]; !found {
+			db.byHash[string(e.hash)] = index
+		}
+	}
+
+	entries := append(db.byClass[e.classID], index)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return compareUnityVersions(db.entries[entries[i]].parsed, db.entries[entries[j]].parsed) < 0
+	})
+	db.byClass[e.classID] = entries
+}
+
+// Adds the type trees of a loaded asset that has them. Returns the number of
+// types added.
+func (db *TypeDatabase) AddAsset(a *Asset) int {
+	if a.Tree == nil || !a.Tree.HasTypeTrees {
+		return 0
+	}
+
+	count := 0
+	for _, st := range a.Tree.SerializedTypes {
+		if st.Tree == nil {
+			continue
+		}
+		db.Add(a.Tree.GeneratorVersion, st.ClassID, st.OldTypeHash, st.Tree)
+		count++
+	}
+	return count
+}
+
+// Calls fn for every type of the database, by class ID and version.
+func (db *TypeDatabase) Each(fn func(version string, classID int32, tree *TypeTree)) {
+	classIDs := make([]int32, 0, len(db.byClass))
+	for classID := range db.byClass {
+		classIDs = append(classIDs, classID)
+	}
+	sort.Slice(classIDs, func(i, j int) bool { return classIDs[i] < classIDs[j] })
+
+	for _, classID := range classIDs {
+		for _, i := range db.byClass[classID] {
+			e := db.entries[i]
+			fn(e.version, e.classID, db.trees[e.tree])
+		}
+	}
+}
+
+// Returns the type tree of a class for a Unity version. A type hash, if
+// given, is looked up first. MonoBehaviour types, and script types with
+// negative class IDs before format 16, are only found by hash, as their
+// trees depend on the script.
+func (db *TypeDatabase) Lookup(version string, classID int32, hash []byte) (*TypeTree, bool) {
+	if len(hash) > 0 && !isZero(hash) {
+		if index, found := db.byHash[string(hash)]; found {
+			return db.trees[db.entries[index].tree], true
+		}
+	}
+	if classID < 0 || classID == int32(MonoBehaviour) {
+		return nil, false
+	}
+
+	v, ok := parseUnityVersion(version)
+	if !ok {
+		return nil, false
+	}
+
+	// Exact version, else the newest older patch release of it
+	var best *typeDatabaseEntry
+	for _, i := range db.byClass[classID] {
+		e := &db.entries[i]
+		if e.parsed[0] != v[0] || e.parsed[1] != v[1] || compareUnityVersions(e.parsed, v) > 0 {
+			continue
+		}
+		if e.version == version {
+			return db.trees[e.tree], true
+		}
+		best = e
+	}
+	if best == nil {
+		return nil, false
+	}
+	return db.trees[best.tree], true
+}
+
+func isZero(b []byte) bool {
+	for _, x := range b {
+		if x != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,222 @@
+package unity
+
+import (
+	"bytes"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestTypeDatabase(t *testing.T) {
+	db := NewTypeDatabase()
+	var assets []*Asset
+	for _, path := range []string{"test/20147_cs_h", "test/main_dxt1_bc1.unity3d"} {
+		data := readTestSerializedFile(t, path)
+		asset, err := OpenAsset(bytes.NewReader(data), int64(len(data)), "CAB")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := db.AddAsset(asset); n != len(asset.Tree.SerializedTypes) {
+			t.Errorf("%v: Added %v of %v types", path, n, len(asset.Tree.SerializedTypes))
+		}
+		assets = append(assets, asset)
+	}
+
+	// Written and read back
+	buf := &bytes.Buffer{}
+	if _, err := db.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadTypeDatabase(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != db.Len() || len(loaded.trees) != len(db.trees) {
+		t.Errorf("Invalid loaded database. Types: %v Trees: %v Expected: %v, %v", loaded.Len(), len(loaded.trees), db.Len(), len(db.trees))
+	}
+	for i := range db.trees {
+		if !reflect.DeepEqual(loaded.trees[i], db.trees[i]) {
+			t.Errorf("Type tree %v mismatch", i)
+		}
+	}
+
+	// Stripped files decode with the type trees of the database
+	for _, asset := range assets {
+		version := asset.Tree.GeneratorVersion
+		asset.Tree.HasTypeTrees = false
+		buf.Reset()
+		if _, err = asset.WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, db := range []*TypeDatabase{nil, loaded} {
+			DefaultTypeDatabase = db
+			stripped, err := OpenAsset(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "CAB")
+			DefaultTypeDatabase = nil
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, pathID := range asset.PathIDs {
+				got, err := stripped.ReadObject(pathID)
+				if db == nil {
+					if err == nil {
+						t.Errorf("%v: Object %v decoded without type trees", version, pathID)
+					}
+					continue
+				}
+				expected, _ := asset.ReadObject(pathID)
+				if err != nil {
+					t.Errorf("%v: Object %v: %v", version, pathID, err)
+				} else if !reflect.DeepEqual(got, expected) {
+					t.Errorf("%v: Object %v mismatch", version, pathID)
+				}
+			}
+		}
+	}
+
+	// Without hashes, types are found for patch releases of the same version
+	version := assets[0].Tree.GeneratorVersion
+	v, _ := parseUnityVersion(version)
+	tests := []struct {
+		version string
+		found   bool
+	}{
+		{version, true},
+		{version + "x", true},
+		{joinVersion(v[0], v[1], v[2]+1) + "f1", true},
+		{joinVersion(v[0], v[1]+1, 0) + "f1", false},
+		{"1.0.0", false},
+		{"unknown", false},
+	}
+	for _, test := range tests {
+		if tree, found := loaded.Lookup(test.version, int32(Texture2D), nil); found != test.found {
+			t.Errorf("Lookup(%v): Got: %v Expected: %v", test.version, found, test.found)
+		} else if found && tree.Type != "Texture2D" {
+			t.Errorf("Lookup(%v): Invalid type %v", test.version, tree.Type)
+		}
+	}
+
+	// Stripped files without hashes store 0.0.0 as their version, and are
+	// looked up with the version of their bundle
+	for _, asset := range assets {
+		version := asset.Tree.GeneratorVersion
+		asset.Tree.GeneratorVersion = "0.0.0"
+		for _, st := range asset.Tree.SerializedTypes {
+			st.OldTypeHash = make([]byte, len(st.OldTypeHash))
+		}
+		serialized := &bytes.Buffer{}
+		if _, err = asset.WriteTo(serialized); err != nil {
+			t.Fatal(err)
+		}
+		nodes := []BundleNode{{Name: "CAB-stripped", Status: NodeStatusSerializedFile, Size: int64(serialized.Len()), Data: bytes.NewReader(serialized.Bytes())}}
+		buf.Reset()
+		if err = WriteBundle(buf, nodes, &WriteOptions{TargetVersion: "5.x.x", GeneratorVersion: version}); err != nil {
+			t.Fatal(err)
+		}
+
+		bundle, err := OpenBundle(bytes.NewReader(buf.Bytes()), int64(buf.Len()), &Options{TypeDatabase: loaded})
+		if err == nil {
+			err = bundle.ResolveAsset(0)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		stripped := bundle.Assets[0]
+		if stripped.Tree.GeneratorVersion != "0.0.0" {
+			t.Errorf("Invalid stripped version %v", stripped.Tree.GeneratorVersion)
+		}
+		for _, pathID := range asset.PathIDs {
+			got, err := stripped.ReadObject(pathID)
+			expected, _ := asset.ReadObject(pathID)
+			if err != nil {
+				t.Errorf("%v: Stripped object %v: %v", version, pathID, err)
+			} else if !reflect.DeepEqual(got, expected) {
+				t.Errorf("%v: Stripped object %v mismatch", version, pathID)
+			}
+		}
+	}
+
+	if _, err = ReadTypeDatabase(bytes.NewReader([]byte("UnityFS\x00"))); err == nil {
+		t.Error("Expected an error for a file that is not a type database")
+	}
+}
+
+func TestLookupScriptType(t *testing.T) {
+	data := readTestSerializedFile(t, "test/20147_cs_h")
+	asset, err := OpenAsset(bytes.NewReader(data), int64(len(data)), "CAB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.Format != 15 {
+		t.Fatalf("Expected a format 15 file. Got: %v", asset.Format)
+	}
+
+	// Before format 16 script types have negative class IDs
+	const scriptClassID = -2
+	for _, st := range asset.Tree.SerializedTypes {
+		if st.ClassID == int32(Texture2D) {
+			st.ClassID = scriptClassID
+			st.ScriptID = make([]byte, 16)
+			st.OldTypeHash = bytes.Repeat([]byte{1}, 16)
+		}
+	}
+	var scriptObjects []int64
+	for _, pathID := range asset.PathIDs {
+		if obj := asset.Objects[pathID]; obj.TypeID == int32(Texture2D) {
+			obj.TypeID = scriptClassID
+			obj.ClassID = int16(MonoBehaviour)
+			asset.Objects[pathID] = obj
+			scriptObjects = append(scriptObjects, pathID)
+		}
+	}
+	if len(scriptObjects) == 0 {
+		t.Fatal("No Texture2D objects")
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err = asset.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	script, err := OpenAsset(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "CAB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := NewTypeDatabase()
+	db.AddAsset(script)
+
+	version := asset.Tree.GeneratorVersion
+	if _, found := db.Lookup(version, scriptClassID, bytes.Repeat([]byte{1}, 16)); !found {
+		t.Error("Script type not found by hash")
+	}
+	if _, found := db.Lookup(version, scriptClassID, nil); found {
+		t.Error("Script type found by class ID")
+	}
+
+	// A stripped file with another script under the same class ID
+	for _, st := range asset.Tree.SerializedTypes {
+		if st.ClassID == scriptClassID {
+			st.OldTypeHash = bytes.Repeat([]byte{2}, 16)
+		}
+	}
+	asset.Tree.HasTypeTrees = false
+	buf.Reset()
+	if _, err = asset.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	DefaultTypeDatabase = db
+	stripped, err := OpenAsset(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "CAB")
+	DefaultTypeDatabase = nil
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pathID := range scriptObjects {
+		if _, err = stripped.ReadObject(pathID); err == nil {
+			t.Errorf("Object %v decoded with the type tree of another script", pathID)
+		}
+	}
+}
+
+func joinVersion(major, minor, patch int) string {
+	return strconv.Itoa(major) + "." + strconv.Itoa(minor) + "." + strconv.Itoa(patch)
+}
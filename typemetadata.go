@@ -1,5 +1,9 @@
 package unity
 
+import (
+	"fmt"
+)
+
 type TypeMetadata struct {
 	GeneratorVersion string
 	TargetPlatform   uint32
@@ -8,9 +12,34 @@ type TypeMetadata struct {
 	ClassIDs         []int32
 	HasTypeTrees     bool
 	NumTypes         int32
+	SerializedTypes  []*SerializedType // In file order
+}
+
+// A type entry of the serialized file metadata as stored in the file
+type SerializedType struct {
+	ClassID         int32 // 114 for all MonoBehaviour types since format 16
+	IsStripped      bool  // Format >= 16
+	ScriptTypeIndex int16 // Format >= 17
+	ScriptID        []byte
+	OldTypeHash     []byte
+	Tree            *TypeTree
+	Dependencies    []int32 // Format >= 21
+
+	// Referenced types since format 21
+	ClassName    string
+	Namespace    string
+	AssemblyName string
+
+	// Serialized type tree and its format, written back as is
+	rawTree   []byte
+	rawFormat uint32
 }
 
 func ReadTypeMetadata(reader *Reader, isLittleEndian bool, formatVer uint32) (*TypeMetadata, error) {
+	return readTypeMetadata(reader, isLittleEndian, formatVer, DefaultLimits.withDefaults())
+}
+
+func readTypeMetadata(reader *Reader, isLittleEndian bool, formatVer uint32, limits Limits) (*TypeMetadata, error) {
 	var err error
 	tm := TypeMetadata{
 		Hashes:    make(map[int32][]byte),
@@ -25,76 +54,209 @@ func ReadTypeMetadata(reader *Reader, isLittleEndian bool, formatVer uint32) (*T
 		return nil, err
 	}
 
+	// Type trees are always present before format 13
+	tm.HasTypeTrees = true
 	if formatVer >= 13 {
 		if hasTypeTrees, err := reader.Uint8(); err != nil {
 			return nil, err
 		} else {
 			tm.HasTypeTrees = hasTypeTrees > 0
 		}
+	}
+
+	if tm.NumTypes, err = reader.Int32(); err != nil {
+		return nil, err
+	}
+	if err = limits.checkCount("type", int64(tm.NumTypes)); err != nil {
+		return nil, err
+	}
 
-		if tm.NumTypes, err = reader.Int32(); err != nil {
+	for i := int32(0); i < tm.NumTypes; i++ {
+		st, err := readSerializedType(reader, isLittleEndian, formatVer, tm.HasTypeTrees, false, commonStrings(tm.GeneratorVersion), limits)
+		if err != nil {
 			return nil, err
 		}
+		tm.SerializedTypes = append(tm.SerializedTypes, st)
 
-		for i := int32(0); i < tm.NumTypes; i++ {
-			var hash []byte
-			classID, err := reader.Int32()
-			if err != nil {
-				return nil, err
+		classID := st.ClassID
+		if formatVer >= 17 && classID == 114 {
+			if st.ScriptTypeIndex >= 0 {
+				classID = -2 - int32(st.ScriptTypeIndex)
+			} else {
+				classID = -1
 			}
+		}
 
-			if formatVer >= 17 {
-				_, _ = reader.Uint8()
-				scriptID, _ := reader.Int16()
-				if classID == 114 {
-					if scriptID >= 0 {
-						classID = -2 - int32(scriptID)
-					} else {
-						classID = -1
-					}
-				}
-			}
+		tm.ClassIDs = append(tm.ClassIDs, classID)
+		if formatVer >= 13 {
+			tm.Hashes[classID] = st.hash()
+		}
+		if st.Tree != nil {
+			tm.TypeTrees[classID] = *st.Tree
+		}
+	}
 
-			if classID < 0 {
-				hash, err = reader.Bytes(0x20)
-			} else {
-				hash, err = reader.Bytes(0x10)
-			}
+	return &tm, nil
+}
 
-			if err != nil {
-				return nil, err
-			}
+// Reads a type entry of the metadata, or of the referenced types when
+// isRefType is set. Type trees resolve common strings with commonStrings.
+func readSerializedType(reader *Reader, isLittleEndian bool, formatVer uint32, hasTypeTree, isRefType bool, commonStrings []byte, limits Limits) (st *SerializedType, err error) {
+	st = &SerializedType{ScriptTypeIndex: -1}
 
-			tm.ClassIDs = append(tm.ClassIDs, classID)
-			tm.Hashes[classID] = hash
+	if st.ClassID, err = reader.Int32(); err != nil {
+		return nil, err
+	}
 
-			if tm.HasTypeTrees {
-				if tt, err := ReadTypeTree(reader, isLittleEndian, formatVer); err != nil {
-					return nil, err
-				} else {
-					tm.TypeTrees[classID] = *tt
-				}
+	if formatVer >= 16 {
+		stripped, err := reader.Uint8()
+		if err != nil {
+			return nil, err
+		}
+		st.IsStripped = stripped != 0
+	}
+
+	if formatVer >= 17 {
+		if st.ScriptTypeIndex, err = reader.Int16(); err != nil {
+			return nil, err
+		}
+	}
+
+	if formatVer >= 13 {
+		if (isRefType && st.ScriptTypeIndex >= 0) ||
+			(formatVer < 16 && st.ClassID < 0) ||
+			(formatVer >= 16 && st.ClassID == 114) {
+			if st.ScriptID, err = reader.Bytes(16); err != nil {
+				return nil, err
 			}
 		}
-	} else {
-		numFields, err := reader.Int32()
-		if err != nil {
+
+		if st.OldTypeHash, err = reader.Bytes(16); err != nil {
 			return nil, err
 		}
+	}
+
+	if !hasTypeTree {
+		return st, nil
+	}
 
-		for i := int32(0); i < numFields; i++ {
-			classID, err := reader.Int32()
+	start := reader.Tell()
+	if st.Tree, err = readTypeTree(reader, isLittleEndian, formatVer, commonStrings, limits); err != nil {
+		return nil, err
+	}
+	st.rawTree = reader.buf[start:reader.Tell()]
+	st.rawFormat = formatVer
+
+	if formatVer >= 21 {
+		if isRefType {
+			if st.ClassName, err = reader.StringNull(); err != nil {
+				return nil, err
+			}
+			if st.Namespace, err = reader.StringNull(); err != nil {
+				return nil, err
+			}
+			if st.AssemblyName, err = reader.StringNull(); err != nil {
+				return nil, err
+			}
+		} else {
+			numDependencies, err := reader.Int32()
+			if err == nil {
+				err = limits.checkCount("type dependency", int64(numDependencies))
+			}
 			if err != nil {
 				return nil, err
 			}
+			for i := int32(0); i < numDependencies; i++ {
+				dependency, err := reader.Int32()
+				if err != nil {
+					return nil, err
+				}
+				st.Dependencies = append(st.Dependencies, dependency)
+			}
+		}
+	}
 
-			if tt, err := ReadTypeTree(reader, isLittleEndian, formatVer); err != nil {
-				return nil, err
-			} else {
-				tm.TypeTrees[classID] = *tt
+	return st, nil
+}
+
+// Returns the script ID followed by the type hash
+func (st *SerializedType) hash() []byte {
+	if st.ScriptID == nil {
+		return st.OldTypeHash
+	}
+	return append(append([]byte{}, st.ScriptID...), st.OldTypeHash...)
+}
+
+// Writes a type entry. The type tree is written back as read, or encoded
+// again when it wasn't read or was read in another format.
+func writeSerializedType(w *Writer, st *SerializedType, formatVer uint32, hasTypeTree, isRefType bool, commonStrings []byte) error {
+	w.Int32(st.ClassID)
+
+	if formatVer >= 16 {
+		if st.IsStripped {
+			w.Uint8(1)
+		} else {
+			w.Uint8(0)
+		}
+	}
+
+	if formatVer >= 17 {
+		w.Int16(st.ScriptTypeIndex)
+	}
+
+	if formatVer >= 13 {
+		w.Write(st.ScriptID)
+		w.Write(st.OldTypeHash)
+	}
+
+	if !hasTypeTree {
+		return nil
+	}
+
+	if st.rawTree != nil && st.rawFormat == formatVer {
+		w.Write(st.rawTree)
+	} else if st.Tree != nil {
+		writeTypeTree(w, st.Tree, formatVer, commonStrings)
+	} else {
+		return fmt.Errorf("unity.writeSerializedType: No type tree for class %v", st.ClassID)
+	}
+
+	if formatVer >= 21 {
+		if isRefType {
+			w.StringNull(st.ClassName)
+			w.StringNull(st.Namespace)
+			w.StringNull(st.AssemblyName)
+		} else {
+			w.Int32(int32(len(st.Dependencies)))
+			for _, dependency := range st.Dependencies {
+				w.Int32(dependency)
 			}
 		}
 	}
 
-	return &tm, nil
+	return nil
+}
+
+// Writes the metadata types in the format of formatVer
+func (tm *TypeMetadata) write(w *Writer, formatVer uint32) error {
+	w.StringNull(tm.GeneratorVersion)
+	w.Uint32(tm.TargetPlatform)
+
+	hasTypeTrees := tm.HasTypeTrees || formatVer < 13
+	if formatVer >= 13 {
+		if hasTypeTrees {
+			w.Uint8(1)
+		} else {
+			w.Uint8(0)
+		}
+	}
+
+	w.Int32(int32(len(tm.SerializedTypes)))
+	for _, st := range tm.SerializedTypes {
+		if err := writeSerializedType(w, st, formatVer, hasTypeTrees, false, commonStrings(tm.GeneratorVersion)); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
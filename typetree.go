@@ -5,109 +5,202 @@ import (
 	"fmt"
 )
 
+// Set in TypeTree.Flags when the reader aligns to 4 bytes after the field
+const TypeTreeAlign = 0x4000
+
 type TypeTree struct {
-	Version    int32
-	Depth      int8
-	IsArray    bool
-	TypeOffset int32
-	Type       string
-	NameOffset int32
-	Name       string
-	Size       int32
-	Index      int64
-	Flags      int32
-	Children   []*TypeTree
+	Version     int32
+	Depth       int8
+	IsArray     bool
+	TypeOffset  int32
+	Type        string
+	NameOffset  int32
+	Name        string
+	Size        int32
+	Index       int64
+	Flags       int32
+	RefTypeHash uint64 // Format >= 19
+	Children    []*TypeTree
+}
+
+// Reports whether the data is aligned to 4 bytes after the field.
+func (tt *TypeTree) Aligned() bool {
+	return tt.Flags&TypeTreeAlign != 0
 }
 
-func readBlobTypeTree(reader *Reader, tt *TypeTree, isLittleEndian bool, formatVer uint32) (err error) {
+// Reads a type tree stored as a node list and a string buffer. Type and name
+// offsets with the top bit set refer to commonStrings.
+func readBlobTypeTree(reader *Reader, tt *TypeTree, isLittleEndian bool, formatVer uint32, commonStrings []byte, limits Limits) (err error) {
 	var nodeData, data []byte
-	numNodes, _ := reader.Uint32()
-	bufferBytes, _ := reader.Uint32()
-	nodeData, _ = reader.Bytes(24 * int64(numNodes))
-	data, err = reader.Bytes(int64(bufferBytes))
+	numNodes, err := reader.Uint32()
+	if err != nil {
+		return err
+	}
+	if err = limits.checkCount("type tree node", int64(numNodes)); err != nil {
+		return err
+	}
+	bufferBytes, err := reader.Uint32()
+	if err != nil {
+		return err
+	}
+	if err = limits.checkAllocation("type tree strings", int64(bufferBytes)); err != nil {
+		return err
+	}
+	nodeSize := int64(24)
+	if formatVer >= 19 {
+		nodeSize = 32
+	}
+	if nodeData, err = reader.Bytes(nodeSize * int64(numNodes)); err != nil {
+		return err
+	}
+	if data, err = reader.Bytes(int64(bufferBytes)); err != nil {
+		return err
+	}
 
-	parents := []*TypeTree{tt}
 	treeReader, err := NewReader(nodeData)
+	if err != nil {
+		return err
+	}
 	treeReader.ChangeEndian(isLittleEndian)
-	currentDepth := int16(-1)
+
+	// Nodes are stored depth first; parents holds the last node of every
+	// depth up to the current one
+	var parents []*TypeTree
 
 	for i := uint32(0); i < numNodes; i++ {
-		_, _ = treeReader.Int16()
-		depth, _ := treeReader.Uint8()
-		isArray, _ := treeReader.Int8()
-		typeOffset, _ := treeReader.Int32()
-		nameOffset, _ := treeReader.Int32()
-		sz, _ := treeReader.Int32()
-		index, _ := treeReader.Uint32()
-		flags, _ := treeReader.Int32()
-
-		node := &TypeTree{
-			Type:    strFromBuf(bufferBytes, data, typeOffset),
-			Name:    strFromBuf(bufferBytes, data, nameOffset),
-			IsArray: isArray > 0,
-			Size:    sz,
-			Index:   int64(index),
-			Flags:   flags,
-		}
-
-		if int16(depth) > currentDepth {
-			parents = append(parents, node)
-			currentDepth = int16(depth)
-			continue
-		}
-
-		for i := int16(0); i < currentDepth-int16(depth)+1; i++ {
-			lastIdx := len(parents) - 1
-			last := parents[lastIdx]
-			parents = parents[:lastIdx]
-			parents[lastIdx-1].Children = append(parents[lastIdx-1].Children, last)
-		}
-
-		if flags&0x4000 > 0 {
-			if _, err = treeReader.Align(); err != nil {
+		version, err := treeReader.Int16()
+		if err != nil {
+			return err
+		}
+		depth, err := treeReader.Uint8()
+		if err != nil {
+			return err
+		}
+		isArray, err := treeReader.Int8()
+		if err != nil {
+			return err
+		}
+		typeOffset, err := treeReader.Int32()
+		if err != nil {
+			return err
+		}
+		nameOffset, err := treeReader.Int32()
+		if err != nil {
+			return err
+		}
+		sz, err := treeReader.Int32()
+		if err != nil {
+			return err
+		}
+		index, err := treeReader.Uint32()
+		if err != nil {
+			return err
+		}
+		flags, err := treeReader.Int32()
+		if err != nil {
+			return err
+		}
+		var refTypeHash uint64
+		if formatVer >= 19 {
+			if refTypeHash, err = treeReader.Uint64(); err != nil {
 				return err
 			}
 		}
 
+		node := tt
+		if i > 0 {
+			node = &TypeTree{}
+		}
+		node.Version = int32(version)
+		node.Depth = int8(depth)
+		node.IsArray = isArray > 0
+		node.TypeOffset = typeOffset
+		node.Type = strFromBuf(bufferBytes, data, commonStrings, typeOffset)
+		node.NameOffset = nameOffset
+		node.Name = strFromBuf(bufferBytes, data, commonStrings, nameOffset)
+		node.Size = sz
+		node.Index = int64(index)
+		node.Flags = flags
+		node.RefTypeHash = refTypeHash
+
+		if i == 0 {
+			if depth != 0 {
+				return fmt.Errorf("unity.readBlobTypeTree: Invalid root depth %v", depth)
+			}
+		} else if depth == 0 || int(depth) > len(parents) {
+			return fmt.Errorf("unity.readBlobTypeTree: Invalid depth %v of node %v", depth, i)
+		} else {
+			parents = parents[:depth]
+			parent := parents[depth-1]
+			parent.Children = append(parent.Children, node)
+		}
 		parents = append(parents, node)
-		currentDepth = int16(depth)
 	}
 
-	fmt.Println(parents)
-
 	return nil
 }
 
-func strFromBuf(sz uint32, buf []byte, offset int32) (str string) {
+func strFromBuf(sz uint32, buf, commonStrings []byte, offset int32) (str string) {
 	var data []byte
 	if offset < 0 {
 		offset &= 0x7fffffff
-		data = STRINGS_DAT
+		data = commonStrings
 	} else if uint32(offset) < sz {
 		data = buf
-	} else {
+	}
+	if int(offset) >= len(data) {
 		return ""
 	}
-	n := int32(bytes.IndexByte(data[offset:], 0))
-	return string(data[offset : offset+n])
+	data = data[offset:]
+	if n := bytes.IndexByte(data, 0); n >= 0 {
+		data = data[:n]
+	}
+	return string(data)
 }
 
-func readOldTypeTree(reader *Reader, tt *TypeTree, isLittleEndian bool) (err error) {
-	tt.Type, _ = reader.StringNull()
-	tt.Name, _ = reader.StringNull()
-	tt.Size, _ = reader.Int32()
-	index, _ := reader.Int32()
-	isArray, _ := reader.Int32()
-	tt.Version, _ = reader.Int32()
-	tt.Flags, _ = reader.Int32()
-	numChildren, _ := reader.Int32()
+func readOldTypeTree(reader *Reader, tt *TypeTree, isLittleEndian bool, depth int, limits Limits) (err error) {
+	if depth > maxTypeTreeDepth {
+		return fmt.Errorf("unity.readOldTypeTree: Type tree deeper than %v", maxTypeTreeDepth)
+	}
+
+	if tt.Type, err = reader.StringNull(); err != nil {
+		return err
+	}
+	if tt.Name, err = reader.StringNull(); err != nil {
+		return err
+	}
+	if tt.Size, err = reader.Int32(); err != nil {
+		return err
+	}
+	index, err := reader.Int32()
+	if err != nil {
+		return err
+	}
+	isArray, err := reader.Int32()
+	if err != nil {
+		return err
+	}
+	if tt.Version, err = reader.Int32(); err != nil {
+		return err
+	}
+	if tt.Flags, err = reader.Int32(); err != nil {
+		return err
+	}
+	numChildren, err := reader.Int32()
+	if err != nil {
+		return err
+	}
+	if err = limits.checkCount("type tree node", int64(numChildren)); err != nil {
+		return err
+	}
 
+	tt.Depth = int8(depth)
 	tt.Index = int64(index)
 	tt.IsArray = isArray > 0
 
 	for i := int32(0); i < numChildren; i++ {
 		node := &TypeTree{}
-		if err = readOldTypeTree(reader, node, isLittleEndian); err != nil {
+		if err = readOldTypeTree(reader, node, isLittleEndian, depth+1, limits); err != nil {
 			return err
 		}
 		tt.Children = append(tt.Children, node)
@@ -116,11 +209,101 @@ func readOldTypeTree(reader *Reader, tt *TypeTree, isLittleEndian bool) (err err
 	return nil
 }
 
+// Reads a type tree, resolving common strings with the newest Unity version.
 func ReadTypeTree(reader *Reader, isLittleEndian bool, formatVer uint32) (*TypeTree, error) {
+	return readTypeTree(reader, isLittleEndian, formatVer, STRINGS_DAT, DefaultLimits.withDefaults())
+}
+
+func readTypeTree(reader *Reader, isLittleEndian bool, formatVer uint32, commonStrings []byte, limits Limits) (*TypeTree, error) {
 	tt := &TypeTree{}
 	if formatVer == 10 || formatVer >= 12 {
-		return tt, readBlobTypeTree(reader, tt, isLittleEndian, formatVer)
+		return tt, readBlobTypeTree(reader, tt, isLittleEndian, formatVer, commonStrings, limits)
+	}
+
+	return tt, readOldTypeTree(reader, tt, isLittleEndian, 0, limits)
+}
+
+// Writes tt in the type tree format of formatVer, as readTypeTree reads it.
+func writeTypeTree(w *Writer, tt *TypeTree, formatVer uint32, commonStrings []byte) {
+	if formatVer == 10 || formatVer >= 12 {
+		writeBlobTypeTree(w, tt, formatVer, commonStrings)
+	} else {
+		writeOldTypeTree(w, tt)
+	}
+}
+
+// Writes tt and its children depth first, each node with its child count.
+func writeOldTypeTree(w *Writer, tt *TypeTree) {
+	w.StringNull(tt.Type)
+	w.StringNull(tt.Name)
+	w.Int32(tt.Size)
+	w.Int32(int32(tt.Index))
+	if tt.IsArray {
+		w.Int32(1)
+	} else {
+		w.Int32(0)
+	}
+	w.Int32(tt.Version)
+	w.Int32(tt.Flags)
+	w.Int32(int32(len(tt.Children)))
+	for _, child := range tt.Children {
+		writeOldTypeTree(w, child)
+	}
+}
+
+// Writes tt as a node list and a string buffer. Common string offsets of the
+// nodes are kept when they refer to the same string in commonStrings; other
+// types and names are stored in the buffer.
+func writeBlobTypeTree(w *Writer, tt *TypeTree, formatVer uint32, commonStrings []byte) {
+	var nodes []*TypeTree
+	var depths []uint8
+	var walk func(node *TypeTree, depth uint8)
+	walk = func(node *TypeTree, depth uint8) {
+		nodes = append(nodes, node)
+		depths = append(depths, depth)
+		for _, child := range node.Children {
+			walk(child, depth+1)
+		}
+	}
+	walk(tt, 0)
+
+	offsets := make(map[string]int32)
+	var buf []byte
+	offset := func(s string, common int32) int32 {
+		if common < 0 && strFromBuf(0, nil, commonStrings, common) == s {
+			return common
+		}
+		if off, found := offsets[s]; found {
+			return off
+		}
+		off := int32(len(buf))
+		offsets[s] = off
+		buf = append(append(buf, s...), 0)
+		return off
+	}
+
+	nodeData := NewWriter()
+	nodeData.endian = w.endian
+	for i, node := range nodes {
+		nodeData.Int16(int16(node.Version))
+		nodeData.Uint8(depths[i])
+		if node.IsArray {
+			nodeData.Int8(1)
+		} else {
+			nodeData.Int8(0)
+		}
+		nodeData.Int32(offset(node.Type, node.TypeOffset))
+		nodeData.Int32(offset(node.Name, node.NameOffset))
+		nodeData.Int32(node.Size)
+		nodeData.Uint32(uint32(node.Index))
+		nodeData.Int32(node.Flags)
+		if formatVer >= 19 {
+			nodeData.Uint64(node.RefTypeHash)
+		}
 	}
 
-	return tt, readOldTypeTree(reader, tt, isLittleEndian)
+	w.Uint32(uint32(len(nodes)))
+	w.Uint32(uint32(len(buf)))
+	w.Write(nodeData.Data())
+	w.Write(buf)
 }
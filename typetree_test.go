@@ -0,0 +1,111 @@
+package unity
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Checks that the nodes of tt are numbered in depth-first order from index.
+func checkTreeIndexes(t *testing.T, tt *TypeTree, index *int64, depth int8) {
+	if tt.Index != *index || tt.Depth != depth {
+		t.Errorf("%v %v: Invalid index or depth. Got: %v, %v Expected: %v, %v", tt.Type, tt.Name, tt.Index, tt.Depth, *index, depth)
+	}
+	*index++
+	for _, child := range tt.Children {
+		checkTreeIndexes(t, child, index, depth+1)
+	}
+}
+
+func TestReadBlobTypeTree(t *testing.T) {
+	data := readTestSerializedFile(t, "test/20147_cs_h")
+	asset, err := OpenAsset(bytes.NewReader(data), int64(len(data)), "CAB")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt, found := asset.Tree.TypeTrees[int32(Texture2D)]
+	if !found {
+		t.Fatal("Texture2D type tree not found")
+	}
+	if tt.Type != "Texture2D" || tt.Name != "Base" || tt.Version != 2 || len(tt.Children) != 15 {
+		t.Fatalf("Invalid root: %v %v v%v with %v children", tt.Type, tt.Name, tt.Version, len(tt.Children))
+	}
+	var index int64
+	checkTreeIndexes(t, &tt, &index, 0)
+	if index != 31 {
+		t.Errorf("Invalid node count: %v", index)
+	}
+
+	name := tt.Children[0]
+	if name.Type != "string" || name.Name != "m_Name" || len(name.Children) != 1 {
+		t.Fatalf("Invalid m_Name node: %+v", name)
+	}
+	if array := name.Children[0]; !array.IsArray || !array.Aligned() || len(array.Children) != 2 {
+		t.Errorf("Invalid m_Name array node: %+v", array)
+	}
+	if readAllowed := tt.Children[7]; readAllowed.Name != "m_ReadAllowed" || !readAllowed.Aligned() {
+		t.Errorf("Expected m_ReadAllowed to be aligned: %+v", readAllowed)
+	}
+	if stream := tt.Children[14]; stream.Type != "StreamingInfo" || len(stream.Children) != 3 || len(stream.Children[2].Children) != 1 {
+		t.Errorf("Invalid m_StreamData node: %+v", stream)
+	}
+}
+
+func writeTestBlobTypeTree(format uint32, depths []uint8, refTypeHash uint64) []byte {
+	w := NewWriter()
+	w.ChangeEndian(true)
+	w.Uint32(uint32(len(depths)))
+	w.Uint32(5)
+	for i, depth := range depths {
+		w.Int16(int16(i + 1))
+		w.Uint8(depth)
+		w.Int8(0)
+		w.Int32(0)
+		w.Int32(0)
+		w.Int32(4)
+		w.Int32(int32(i))
+		w.Int32(TypeTreeAlign)
+		if format >= 19 {
+			w.Uint64(refTypeHash)
+		}
+	}
+	w.StringNull("test")
+	return w.Data()
+}
+
+func TestReadBlobTypeTreeFormat(t *testing.T) {
+	// Version 19 nodes end with a reference type hash
+	for _, format := range []uint32{17, 19, 22} {
+		reader, _ := NewReader(writeTestBlobTypeTree(format, []uint8{0, 1, 2, 1}, 0x0123456789abcdef))
+		reader.ChangeEndian(true)
+		tt, err := ReadTypeTree(reader, true, format)
+		if err != nil {
+			t.Fatalf("Format %v: %v", format, err)
+		}
+		if !reader.IsEmpty() {
+			t.Errorf("Format %v: %v bytes left", format, reader.Remaining())
+		}
+
+		var hash uint64
+		if format >= 19 {
+			hash = 0x0123456789abcdef
+		}
+		if tt.Type != "test" || tt.Version != 1 || tt.RefTypeHash != hash || !tt.Aligned() {
+			t.Errorf("Format %v: Invalid root: %+v", format, tt)
+		}
+		if len(tt.Children) != 2 || len(tt.Children[0].Children) != 1 || tt.Children[1].Version != 4 {
+			t.Errorf("Format %v: Invalid tree shape", format)
+		}
+		var index int64
+		checkTreeIndexes(t, tt, &index, 0)
+	}
+
+	// Nodes must follow their parents and there is a single root
+	for _, depths := range [][]uint8{{1}, {0, 2}, {0, 1, 0}} {
+		reader, _ := NewReader(writeTestBlobTypeTree(19, depths, 0))
+		reader.ChangeEndian(true)
+		if _, err := ReadTypeTree(reader, true, 19); err == nil {
+			t.Errorf("Depths %v: Expected an error", depths)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package unity
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FieldError lists the fields that differ between the type tree of an object
+// and the Go value it was unmarshaled into. All matching fields are set.
+type FieldError struct {
+	Missing []string // Go fields without data
+	Extra   []string // Fields of the data without a Go field
+}
+
+func (e *FieldError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing fields: "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Extra) > 0 {
+		parts = append(parts, "extra fields: "+strings.Join(e.Extra, ", "))
+	}
+	return "unity: Unmarshal: " + strings.Join(parts, "; ")
+}
+
+// Decodes the object with the given path ID into v, which must be a non-nil
+// pointer, typically to a struct.
+//
+// Struct fields are matched by their `field` tag, or else by their name
+// prefixed with "m_" as in Unity: a Name field holds m_Name. Fields tagged
+// "-" and unexported fields are skipped, and the fields of embedded structs
+// are matched as if they were fields of the outer struct. Arrays fill slices
+// and Go arrays, maps fill maps, pairs fill structs with first and second
+// fields, and structs also fill slices field by field, as for vectors.
+// Numbers are converted to the Go field type when they fit.
+//
+// When fields of the data and of v don't match, the matching fields are set
+// and a *FieldError is returned.
+func (a *Asset) Unmarshal(pathID int64, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("unity.Asset.Unmarshal: Non-nil pointer required")
+	}
+
+	obj, err := a.ReadObject(pathID)
+	if err != nil {
+		return err
+	}
+
+	return unmarshalValue(obj, rv.Elem())
+}
+
+func unmarshalValue(src interface{}, v reflect.Value) error {
+	u := unmarshaler{seen: make(map[string]bool)}
+	if err := u.value(src, v, ""); err != nil {
+		return fmt.Errorf("unity.Asset.Unmarshal: %w", err)
+	}
+	if len(u.missing) > 0 || len(u.extra) > 0 {
+		return &FieldError{Missing: u.missing, Extra: u.extra}
+	}
+	return nil
+}
+
+type unmarshaler struct {
+	missing []string
+	extra   []string
+	seen    map[string]bool // Reported fields, once for all array elements
+}
+
+func (u *unmarshaler) value(src interface{}, v reflect.Value, path string) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		v.Set(reflect.ValueOf(src))
+		return nil
+	}
+
+	switch src := src.(type) {
+	case *Struct:
+		return u.fields(src.Fields, v, path)
+	case Pair:
+		return u.fields([]Field{{Name: "first", Value: src.First}, {Name: "second", Value: src.Second}}, v, path)
+	case []Pair:
+		if v.Kind() == reflect.Map {
+			return u.mapValue(src, v, path)
+		}
+		elements := make([]interface{}, len(src))
+		for i := range src {
+			elements[i] = src[i]
+		}
+		return u.elements(elements, v, path)
+	case []interface{}:
+		return u.elements(src, v, path)
+	case []byte:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes(append([]byte(nil), src...))
+			return nil
+		}
+		elements := make([]interface{}, len(src))
+		for i := range src {
+			elements[i] = src[i]
+		}
+		return u.elements(elements, v, path)
+	case string:
+		if v.Kind() != reflect.String {
+			return u.typeError(src, v, path)
+		}
+		v.SetString(src)
+		return nil
+	}
+
+	return u.primitive(src, v, path)
+}
+
+// Sets the fields of a struct, the elements of a slice or the entries of a
+// map with string keys.
+func (u *unmarshaler) fields(fields []Field, v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Struct:
+	case reflect.Slice, reflect.Array:
+		elements := make([]interface{}, len(fields))
+		for i, field := range fields {
+			elements[i] = field.Value
+		}
+		return u.elements(elements, v, path)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("%v: Map keys of %v must be strings", path, v.Type())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for _, field := range fields {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := u.value(field.Value, elem, joinPath(path, field.Name)); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(field.Name).Convert(v.Type().Key()), elem)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%v: Cannot unmarshal a struct into %v", path, v.Type())
+	}
+
+	targets := make(map[string]reflect.Value)
+	var names []string
+	structFields(v, targets, &names)
+
+	used := make(map[string]bool)
+	for _, field := range fields {
+		fieldPath := joinPath(path, field.Name)
+		target, found := targets[field.Name]
+		if !found {
+			u.report(&u.extra, fieldPath)
+			continue
+		}
+		used[field.Name] = true
+		if err := u.value(field.Value, target, fieldPath); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		if !used[name] {
+			u.report(&u.missing, joinPath(path, name))
+		}
+	}
+	return nil
+}
+
+// Collects the settable fields of a struct by data field name. Fields of the
+// outer struct hide those of embedded structs.
+func structFields(v reflect.Value, targets map[string]reflect.Value, names *[]string) {
+	t := v.Type()
+	var embedded []reflect.Value
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("field")
+		if tag == "-" {
+			continue
+		}
+		if sf.Anonymous && tag == "" && sf.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, v.Field(i))
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		name := tag
+		if name == "" {
+			name = "m_" + sf.Name
+		}
+		if _, found := targets[name]; !found {
+			targets[name] = v.Field(i)
+			*names = append(*names, name)
+		}
+	}
+
+	for _, e := range embedded {
+		structFields(e, targets, names)
+	}
+}
+
+func (u *unmarshaler) elements(src []interface{}, v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Len() != len(src) {
+			v.Set(reflect.MakeSlice(v.Type(), len(src), len(src)))
+		}
+	case reflect.Array:
+		if v.Len() != len(src) {
+			return fmt.Errorf("%v: Cannot unmarshal %v elements into %v", path, len(src), v.Type())
+		}
+	default:
+		return fmt.Errorf("%v: Cannot unmarshal an array into %v", path, v.Type())
+	}
+
+	for i := range src {
+		if err := u.value(src[i], v.Index(i), path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *unmarshaler) mapValue(src []Pair, v reflect.Value, path string) error {
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(v.Type(), len(src)))
+	}
+	for _, pair := range src {
+		key := reflect.New(v.Type().Key()).Elem()
+		if err := u.value(pair.First, key, path); err != nil {
+			return err
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := u.value(pair.Second, elem, path); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+	}
+	return nil
+}
+
+// Sets a bool or a number, converting numbers to the kind of v.
+func (u *unmarshaler) primitive(src interface{}, v reflect.Value, path string) error {
+	sv := reflect.ValueOf(src)
+	switch sv.Kind() {
+	case reflect.Bool:
+		if v.Kind() != reflect.Bool {
+			return u.typeError(src, v, path)
+		}
+		v.SetBool(sv.Bool())
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+			return u.typeError(src, v, path)
+		}
+		v.SetFloat(sv.Float())
+		return nil
+
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return u.integer(sv.Int(), sv.Int() < 0, uint64(sv.Int()), src, v, path)
+
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return u.integer(int64(sv.Uint()), false, sv.Uint(), src, v, path)
+	}
+
+	return u.typeError(src, v, path)
+}
+
+func (u *unmarshaler) integer(i int64, negative bool, n uint64, src interface{}, v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		// Flags such as m_Enabled are stored as UInt8
+		v.SetBool(n != 0)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !negative && n > 1<<63-1 || v.OverflowInt(i) {
+			return fmt.Errorf("%v: %v overflows %v", path, src, v.Type())
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if negative || v.OverflowUint(n) {
+			return fmt.Errorf("%v: %v overflows %v", path, src, v.Type())
+		}
+		v.SetUint(n)
+		return nil
+	}
+	return u.typeError(src, v, path)
+}
+
+func (u *unmarshaler) typeError(src interface{}, v reflect.Value, path string) error {
+	return fmt.Errorf("%v: Cannot unmarshal %T into %v", path, src, v.Type())
+}
+
+func (u *unmarshaler) report(list *[]string, path string) {
+	if !u.seen[path] {
+		u.seen[path] = true
+		*list = append(*list, path)
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,204 @@
+package unity
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zklm/unity/engine"
+)
+
+type testTexture2D struct {
+	Name            string
+	Width           int32
+	Height          int32
+	TextureFormat   int32
+	IsReadable      bool
+	TextureSettings struct {
+		FilterMode int32
+		Aniso      int32
+		MipBias    float32
+		WrapMode   int32
+	}
+	ImageData  []byte `field:"image data"`
+	StreamData engine.StreamingInfo
+}
+
+type testAssetInfo struct {
+	PreloadIndex int32       `field:"preloadIndex"`
+	PreloadSize  int32       `field:"preloadSize"`
+	Asset        engine.PPtr `field:"asset"`
+}
+
+type testAssetBundle struct {
+	Name            string
+	PreloadTable    []engine.PPtr
+	Container       map[string]testAssetInfo
+	MainAsset       testAssetInfo
+	AssetBundleName string
+	Dependencies    []string
+}
+
+func TestUnmarshal(t *testing.T) {
+	data := readTestSerializedFile(t, "test/20147_cs_h")
+	asset, err := OpenAsset(bytes.NewReader(data), int64(len(data)), "CAB")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pathID := range asset.PathIDs {
+		obj, err := asset.ReadObject(pathID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		get := func(name string) interface{} {
+			value, _ := obj.Get(name)
+			return value
+		}
+
+		switch obj.Type {
+		case "Texture2D":
+			var tex testTexture2D
+			err = asset.Unmarshal(pathID, &tex)
+			var fe *FieldError
+			if !errors.As(err, &fe) || len(fe.Missing) > 0 || len(fe.Extra) == 0 {
+				t.Fatalf("Expected extra fields only. Got: %v", err)
+			}
+			if tex.Name != get("m_Name") || tex.Width != get("m_Width") || !bytes.Equal(tex.ImageData, get("image data").([]byte)) {
+				t.Errorf("Invalid texture: %+v", tex)
+			}
+			settings := get("m_TextureSettings").(*Struct)
+			if mipBias, _ := settings.Get("m_MipBias"); tex.TextureSettings.MipBias != mipBias {
+				t.Errorf("Invalid texture settings: %+v", tex.TextureSettings)
+			}
+			stream := get("m_StreamData").(*Struct)
+			if offset, _ := stream.Get("offset"); uint64(offset.(uint32)) != tex.StreamData.Offset {
+				t.Errorf("Invalid streaming info: %+v", tex.StreamData)
+			}
+
+		case "AssetBundle":
+			var bundle testAssetBundle
+			err = asset.Unmarshal(pathID, &bundle)
+			var fe *FieldError
+			if !errors.As(err, &fe) || !reflect.DeepEqual(fe.Extra, []string{"m_RuntimeCompatibility", "m_IsStreamedSceneAssetBundle"}) || len(fe.Missing) > 0 {
+				t.Fatalf("Invalid field error: %v", err)
+			}
+			container := get("m_Container").([]Pair)
+			if len(bundle.Container) != len(container) || len(bundle.PreloadTable) != len(get("m_PreloadTable").([]interface{})) {
+				t.Errorf("Invalid asset bundle: %+v", bundle)
+			}
+			for _, pair := range container {
+				info := bundle.Container[pair.First.(string)]
+				asset, _ := pair.Second.(*Struct).Get("asset")
+				pathID, _ := asset.(*Struct).Get("m_PathID")
+				if info.Asset.PathID != pathID {
+					t.Errorf("%v: Invalid container entry: %+v", pair.First, info)
+				}
+			}
+
+			// The generated engine types match the data
+			var generated engine.AssetBundle
+			if err = asset.Unmarshal(pathID, &generated); err != nil {
+				t.Fatal(err)
+			}
+			for i, pptr := range generated.PreloadTable {
+				if engine.PPtr(pptr) != bundle.PreloadTable[i] {
+					t.Errorf("Invalid generated preload table entry %v: %+v", i, pptr)
+				}
+			}
+		}
+	}
+
+	if err = asset.Unmarshal(asset.PathIDs[0], testAssetBundle{}); err == nil {
+		t.Error("Expected an error without a pointer")
+	}
+}
+
+func testPPtr(fileID int32, pathID int64) *Struct {
+	return &Struct{Type: "PPtr<Object>", Fields: []Field{
+		{"m_FileID", "int", fileID},
+		{"m_PathID", "SInt64", pathID},
+	}}
+}
+
+func testVector(values ...float32) *Struct {
+	s := &Struct{Type: "Vector3f"}
+	for i, v := range values {
+		s.Fields = append(s.Fields, Field{string("xyzw"[i]), "float", v})
+	}
+	return s
+}
+
+func TestUnmarshalEngine(t *testing.T) {
+	transform := &Struct{Type: "Transform", Fields: []Field{
+		{"m_GameObject", "PPtr<GameObject>", testPPtr(0, 5)},
+		{"m_LocalRotation", "Quaternionf", testVector(0, 0, 0, 1)},
+		{"m_LocalPosition", "Vector3f", testVector(1, 2, 3)},
+		{"m_LocalScale", "Vector3f", testVector(1, 1, 1)},
+		{"m_Children", "vector", []interface{}{testPPtr(0, 7), testPPtr(1, 8)}},
+		{"m_Father", "PPtr<Transform>", testPPtr(0, 0)},
+	}}
+	var tr engine.Transform
+	if err := unmarshalValue(transform, reflect.ValueOf(&tr).Elem()); err != nil {
+		t.Fatal(err)
+	}
+	expected := engine.Transform{
+		Component:     engine.Component{GameObject: engine.PPtr{PathID: 5}},
+		LocalRotation: []float32{0, 0, 0, 1},
+		LocalPosition: []float32{1, 2, 3},
+		LocalScale:    []float32{1, 1, 1},
+		Children:      []engine.PPtr{{PathID: 7}, {FileID: 1, PathID: 8}},
+	}
+	if !reflect.DeepEqual(tr, expected) {
+		t.Errorf("Invalid transform. Got: %+v Expected: %+v", tr, expected)
+	}
+
+	gameObject := &Struct{Type: "GameObject", Fields: []Field{
+		{"m_Component", "vector", []interface{}{
+			&Struct{Type: "ComponentPair", Fields: []Field{{"component", "PPtr<Component>", testPPtr(0, 6)}}},
+		}},
+		{"m_Layer", "unsigned int", uint32(5)},
+		{"m_Name", "string", "Player"},
+		{"m_Tag", "UInt16", uint16(0)},
+		{"m_IsActive", "bool", true},
+	}}
+	var obj engine.GameObject
+	if err := unmarshalValue(gameObject, reflect.ValueOf(&obj).Elem()); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Name != "Player" || obj.Layer != 5 || !obj.Active || len(obj.Components) != 1 || obj.Components[0].Component.PathID != 6 {
+		t.Errorf("Invalid game object: %+v", obj)
+	}
+
+	// Fields are reported once for all array elements
+	var behaviour struct {
+		engine.Behaviour
+		Items []struct{ Value int16 }
+	}
+	src := &Struct{Fields: []Field{
+		{"m_Enabled", "UInt8", uint8(1)},
+		{"m_Items", "vector", []interface{}{
+			&Struct{Fields: []Field{{"m_Value", "int", int32(1)}, {"m_Other", "int", int32(2)}}},
+			&Struct{Fields: []Field{{"m_Value", "int", int32(3)}, {"m_Other", "int", int32(4)}}},
+		}},
+	}}
+	err := unmarshalValue(src, reflect.ValueOf(&behaviour).Elem())
+	var fe *FieldError
+	if !errors.As(err, &fe) || !reflect.DeepEqual(fe.Missing, []string{"m_GameObject"}) || !reflect.DeepEqual(fe.Extra, []string{"m_Items.m_Other"}) {
+		t.Errorf("Invalid field error: %v", err)
+	}
+	if !behaviour.Enabled || len(behaviour.Items) != 2 || behaviour.Items[1].Value != 3 {
+		t.Errorf("Invalid behaviour: %+v", behaviour)
+	}
+
+	// Numbers must fit
+	var small struct{ Value int16 }
+	if err = unmarshalValue(&Struct{Fields: []Field{{"m_Value", "int", int32(1 << 20)}}}, reflect.ValueOf(&small).Elem()); err == nil {
+		t.Error("Expected an overflow error")
+	}
+	var unsigned struct{ Value uint32 }
+	if err = unmarshalValue(&Struct{Fields: []Field{{"m_Value", "int", int32(-1)}}}, reflect.ValueOf(&unsigned).Elem()); err == nil {
+		t.Error("Expected an error for a negative unsigned value")
+	}
+}
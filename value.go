@@ -0,0 +1,267 @@
+package unity
+
+import (
+	"fmt"
+	"math"
+)
+
+// Struct is a decoded structured value, keeping the fields in the order of
+// its type tree.
+type Struct struct {
+	Type   string
+	Fields []Field
+}
+
+// Field is a named value of a Struct.
+type Field struct {
+	Name  string
+	Type  string
+	Value interface{}
+}
+
+// Pair is a decoded pair, and an entry of a decoded map.
+type Pair struct {
+	First  interface{}
+	Second interface{}
+}
+
+// Returns the value of the field with the given name.
+func (s *Struct) Get(name string) (interface{}, bool) {
+	for _, field := range s.Fields {
+		if field.Name == name {
+			return field.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Decodes the object with the given path ID with its type tree. Values are
+// *Struct for structured types, []Pair for maps, Pair for pairs, string,
+// []byte for byte arrays and TypelessData, []interface{} for other arrays,
+// and bool, intN, uintN, float32 or float64 for primitives. Byte arrays are
+// copied, so values stay valid after the asset is closed.
+func (a *Asset) ReadObject(pathID int64) (*Struct, error) {
+	obj, found := a.Objects[pathID]
+	if !found {
+		return nil, fmt.Errorf("unity.Asset.ReadObject: Object not found: %v", pathID)
+	}
+	tree, found := a.objectType(&obj)
+	if !found || len(tree.Children) == 0 && tree.Type == "" {
+		return nil, fmt.Errorf("unity.Asset.ReadObject: No type tree for object %v of type %v", pathID, obj.TypeID)
+	}
+
+	data, err := a.ObjectData(pathID)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := decodeObject(tree, data, a.IsLittleEndian, a.limits())
+	if err != nil {
+		return nil, fmt.Errorf("unity.Asset.ReadObject: Object %v: %w", pathID, err)
+	}
+	return value, nil
+}
+
+// Returns the type tree of an object. From format 16 on objects refer to their
+// own type entry, as MonoBehaviour types share a class ID.
+func (a *Asset) objectType(obj *ObjectInfo) (*TypeTree, bool) {
+	if a.Format >= 16 && obj.TypeIndex >= 0 && int(obj.TypeIndex) < len(a.Tree.SerializedTypes) {
+		if tree := a.Tree.SerializedTypes[obj.TypeIndex].Tree; tree != nil {
+			return tree, true
+		}
+	}
+
+	tree, found := a.Types[obj.TypeID]
+	return &tree, found
+}
+
+// Decodes data with the type tree of its class, which must use all of it.
+func decodeObject(tree *TypeTree, data []byte, isLittleEndian bool, limits Limits) (*Struct, error) {
+	reader, _ := NewReader(data)
+	reader.ChangeEndian(isLittleEndian)
+	d := valueDecoder{reader, limits}
+
+	value, err := d.decodeStruct(tree)
+	if err != nil {
+		return nil, err
+	}
+	if !reader.IsEmpty() {
+		return nil, fmt.Errorf("Read %v of %v bytes", reader.Tell(), reader.Len())
+	}
+	return value, nil
+}
+
+type valueDecoder struct {
+	reader *Reader
+	limits Limits
+}
+
+// Decodes the value of a node, then aligns if the node requires it.
+func (d *valueDecoder) decode(node *TypeTree) (value interface{}, err error) {
+	switch {
+	case node.IsArray:
+		value, err = d.decodeArray(node)
+	case node.Type == "string" && len(node.Children) == 1:
+		value, err = d.decodeString(node)
+	case len(node.Children) == 1 && node.Children[0].IsArray:
+		// Containers such as vector, set, map and staticvector
+		value, err = d.decode(node.Children[0])
+	case node.Type == "pair" && len(node.Children) == 2:
+		value, err = d.decodePair(node)
+	case len(node.Children) > 0:
+		value, err = d.decodeStruct(node)
+	default:
+		value, err = d.decodePrimitive(node)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if node.Aligned() {
+		if _, err = d.reader.AlignTo(4); err != nil {
+			return nil, fmt.Errorf("%v %v: Alignment past the end of the data", node.Type, node.Name)
+		}
+	}
+	return value, nil
+}
+
+func (d *valueDecoder) decodeStruct(node *TypeTree) (*Struct, error) {
+	s := &Struct{Type: node.Type, Fields: make([]Field, 0, len(node.Children))}
+	for _, child := range node.Children {
+		value, err := d.decode(child)
+		if err != nil {
+			return nil, err
+		}
+		s.Fields = append(s.Fields, Field{child.Name, child.Type, value})
+	}
+	return s, nil
+}
+
+// Reads an array node, whose children are the element count and the
+// element type.
+func (d *valueDecoder) decodeArray(node *TypeTree) (interface{}, error) {
+	if len(node.Children) != 2 {
+		return nil, fmt.Errorf("%v %v: Invalid array with %v children", node.Type, node.Name, len(node.Children))
+	}
+
+	count, err := d.reader.Int32()
+	if err != nil {
+		return nil, fmt.Errorf("%v %v: %w", node.Type, node.Name, err)
+	}
+	if err = d.limits.checkCount("array element", int64(count)); err != nil {
+		return nil, fmt.Errorf("%v %v: %w", node.Type, node.Name, err)
+	}
+
+	element := node.Children[1]
+	if len(element.Children) == 0 && element.Size == 1 && isByteType(element.Type) && !element.Aligned() {
+		data, err := d.reader.Bytes(int64(count))
+		if err != nil {
+			return nil, fmt.Errorf("%v %v: %w", node.Type, node.Name, err)
+		}
+		return append([]byte{}, data...), nil
+	}
+
+	// Every element takes at least a byte, except for empty structs
+	if element.Size > 0 && int64(count) > d.reader.Remaining() {
+		return nil, fmt.Errorf("%v %v: %v elements above the %v bytes left", node.Type, node.Name, count, d.reader.Remaining())
+	}
+
+	// Elements of variable size may take many bytes each, so the count only
+	// bounds the initial capacity by the bytes left
+	capacity := int64(count)
+	if capacity > d.reader.Remaining() {
+		capacity = d.reader.Remaining()
+	}
+
+	if element.Type == "pair" && len(element.Children) == 2 {
+		pairs := make([]Pair, 0, capacity)
+		for i := int32(0); i < count; i++ {
+			pair, err := d.decode(element)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, pair.(Pair))
+		}
+		return pairs, nil
+	}
+
+	values := make([]interface{}, 0, capacity)
+	for i := int32(0); i < count; i++ {
+		value, err := d.decode(element)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (d *valueDecoder) decodePair(node *TypeTree) (pair Pair, err error) {
+	if pair.First, err = d.decode(node.Children[0]); err != nil {
+		return pair, err
+	}
+	pair.Second, err = d.decode(node.Children[1])
+	return pair, err
+}
+
+// Reads a string, stored as an array of chars.
+func (d *valueDecoder) decodeString(node *TypeTree) (string, error) {
+	value, err := d.decode(node.Children[0])
+	if err != nil {
+		return "", err
+	}
+	data, ok := value.([]byte)
+	if !ok {
+		return "", fmt.Errorf("%v %v: Invalid string array", node.Type, node.Name)
+	}
+	return string(data), nil
+}
+
+func (d *valueDecoder) decodePrimitive(node *TypeTree) (value interface{}, err error) {
+	r := d.reader
+	switch node.Type {
+	case "bool":
+		var b uint8
+		b, err = r.Uint8()
+		value = b != 0
+	case "SInt8":
+		value, err = r.Int8()
+	case "UInt8", "char":
+		value, err = r.Uint8()
+	case "SInt16", "short":
+		value, err = r.Int16()
+	case "UInt16", "unsigned short":
+		value, err = r.Uint16()
+	case "SInt32", "int", "Type*":
+		value, err = r.Int32()
+	case "UInt32", "unsigned int":
+		value, err = r.Uint32()
+	case "SInt64", "long long":
+		value, err = r.Int64()
+	case "UInt64", "unsigned long long", "FileSize":
+		value, err = r.Uint64()
+	case "float":
+		var bits uint32
+		bits, err = r.Uint32()
+		value = math.Float32frombits(bits)
+	case "double":
+		var bits uint64
+		bits, err = r.Uint64()
+		value = math.Float64frombits(bits)
+	default:
+		if node.Size < 0 {
+			return nil, fmt.Errorf("%v %v: Unknown type without a size", node.Type, node.Name)
+		}
+		var data []byte
+		data, err = r.Bytes(int64(node.Size))
+		value = append([]byte{}, data...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v %v: %w", node.Type, node.Name, err)
+	}
+	return value, nil
+}
+
+func isByteType(t string) bool {
+	return t == "UInt8" || t == "SInt8" || t == "char"
+}
@@ -0,0 +1,221 @@
+package unity
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+)
+
+func TestReadObject(t *testing.T) {
+	for _, path := range []string{"test/20147_cs_h", "test/main_dxt1_bc1.unity3d"} {
+		data := readTestSerializedFile(t, path)
+		asset, err := OpenAsset(bytes.NewReader(data), int64(len(data)), "CAB")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, pathID := range asset.PathIDs {
+			obj, err := asset.ReadObject(pathID)
+			if err != nil {
+				t.Errorf("%v: %v", path, err)
+				continue
+			}
+			t.Logf("%v %v: %v with %v fields", path, pathID, obj.Type, len(obj.Fields))
+
+			switch obj.Type {
+			case "Texture2D":
+				name, _ := obj.Get("m_Name")
+				width, _ := obj.Get("m_Width")
+				image, _ := obj.Get("image data")
+				if _, ok := name.(string); !ok {
+					t.Errorf("%v: Invalid m_Name: %#v", pathID, name)
+				}
+				if w, ok := width.(int32); !ok || w <= 0 {
+					t.Errorf("%v: Invalid m_Width: %#v", pathID, width)
+				}
+				if _, ok := image.([]byte); !ok {
+					t.Errorf("%v: Invalid image data: %T", pathID, image)
+				}
+			case "AssetBundle":
+				container, _ := obj.Get("m_Container")
+				pairs, ok := container.([]Pair)
+				if !ok || len(pairs) == 0 {
+					t.Fatalf("%v: Invalid m_Container: %#v", pathID, container)
+				}
+				if _, ok := pairs[0].First.(string); !ok {
+					t.Errorf("%v: Invalid container key: %#v", pathID, pairs[0].First)
+				}
+				info, ok := pairs[0].Second.(*Struct)
+				if !ok || len(info.Fields) != 3 || info.Fields[2].Type != "PPtr<Object>" {
+					t.Errorf("%v: Invalid container value: %#v", pathID, pairs[0].Second)
+				}
+			}
+		}
+	}
+}
+
+func TestReadObjectTypeIndex(t *testing.T) {
+	for _, path := range []string{"test/20147_cs_h", "test/main_dxt1_bc1.unity3d"} {
+		data := readTestSerializedFile(t, path)
+		asset, err := OpenAsset(bytes.NewReader(data), int64(len(data)), "CAB")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if asset.Format < 16 {
+			continue
+		}
+
+		// Objects use their own type entry, not the tree of their class ID
+		for typeID := range asset.Types {
+			asset.Types[typeID] = TypeTree{Type: "Other", Name: "Base"}
+		}
+		for _, pathID := range asset.PathIDs {
+			obj, err := asset.ReadObject(pathID)
+			if err != nil {
+				t.Fatalf("%v: %v", path, err)
+			}
+			if obj.Type == "Other" {
+				t.Errorf("%v %v: Decoded with the class ID tree", path, pathID)
+			}
+
+			// Byte arrays don't alias the object data
+			image, found := obj.Get("image data")
+			if b, ok := image.([]byte); found && ok && len(b) > 0 {
+				b[0] ^= 0xff
+				objData, _ := asset.ObjectData(pathID)
+				if bytes.Contains(objData, b) {
+					t.Errorf("%v %v: Image data shares memory with the asset", path, pathID)
+				}
+			}
+		}
+	}
+}
+
+// A struct with an aligned bool, a string, a vector of shorts and a map
+func testValueTree() *TypeTree {
+	str := func(name string) *TypeTree {
+		return &TypeTree{Type: "string", Name: name, Size: -1, Children: []*TypeTree{{
+			Type: "Array", Name: "Array", IsArray: true, Size: -1, Flags: TypeTreeAlign, Children: []*TypeTree{
+				{Type: "int", Name: "size", Size: 4},
+				{Type: "char", Name: "data", Size: 1},
+			}}}}
+	}
+	return &TypeTree{Type: "Test", Name: "Base", Size: -1, Children: []*TypeTree{
+		{Type: "bool", Name: "m_Enabled", Size: 1, Flags: TypeTreeAlign},
+		str("m_Name"),
+		{Type: "vector", Name: "m_Values", Size: -1, Children: []*TypeTree{{
+			Type: "Array", Name: "Array", IsArray: true, Size: -1, Flags: TypeTreeAlign, Children: []*TypeTree{
+				{Type: "int", Name: "size", Size: 4},
+				{Type: "SInt16", Name: "data", Size: 2},
+			}}}},
+		{Type: "map", Name: "m_Map", Size: -1, Children: []*TypeTree{{
+			Type: "Array", Name: "Array", IsArray: true, Size: -1, Children: []*TypeTree{
+				{Type: "int", Name: "size", Size: 4},
+				{Type: "pair", Name: "data", Size: -1, Children: []*TypeTree{
+					str("first"),
+					{Type: "float", Name: "second", Size: 4},
+				}},
+			}}}},
+		{Type: "UInt64", Name: "m_ID", Size: 8},
+	}}
+}
+
+func writeTestValue(isLittleEndian bool) []byte {
+	w := NewWriter()
+	w.ChangeEndian(isLittleEndian)
+	w.Uint8(1)
+	w.Align()
+	w.Int32(3)
+	w.Write([]byte("abc"))
+	w.Align()
+	w.Int32(3)
+	w.Int16(-1)
+	w.Int16(2)
+	w.Int16(3)
+	w.Align()
+	w.Int32(1)
+	w.Int32(4)
+	w.Write([]byte("key1"))
+	w.Uint32(0x3fc00000) // 1.5
+	w.Uint64(1 << 40)
+	return w.Data()
+}
+
+func TestDecodeObject(t *testing.T) {
+	for _, isLittleEndian := range []bool{true, false} {
+		data := writeTestValue(isLittleEndian)
+		value, err := decodeObject(testValueTree(), data, isLittleEndian, DefaultLimits)
+		if err != nil {
+			t.Fatalf("Little endian %v: %v", isLittleEndian, err)
+		}
+
+		expected := []Field{
+			{"m_Enabled", "bool", true},
+			{"m_Name", "string", "abc"},
+			{"m_Values", "vector", []interface{}{int16(-1), int16(2), int16(3)}},
+			{"m_Map", "map", []Pair{{"key1", float32(1.5)}}},
+			{"m_ID", "UInt64", uint64(1 << 40)},
+		}
+		if value.Type != "Test" || len(value.Fields) != len(expected) {
+			t.Fatalf("Little endian %v: Invalid value: %#v", isLittleEndian, value)
+		}
+		for i, field := range value.Fields {
+			if field.Name != expected[i].Name || field.Type != expected[i].Type || !valuesEqual(field.Value, expected[i].Value) {
+				t.Errorf("Little endian %v: Invalid field %v. Got: %#v Expected: %#v", isLittleEndian, i, field, expected[i])
+			}
+		}
+
+		// Every byte is used
+		if _, err = decodeObject(testValueTree(), append(data, 0, 0, 0, 0), isLittleEndian, DefaultLimits); err == nil {
+			t.Error("Expected an error for trailing data")
+		}
+		if _, err = decodeObject(testValueTree(), data[:len(data)-1], isLittleEndian, DefaultLimits); err == nil {
+			t.Error("Expected an error for truncated data")
+		}
+	}
+
+	// A large map count without data fails without reserving its elements
+	w := NewWriter()
+	w.Uint8(1)
+	w.Align()
+	w.Int32(0)
+	w.Int32(0)
+	w.Int32(int32(DefaultLimits.MaxNodeCount))
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := decodeObject(testValueTree(), w.Data(), false, DefaultLimits); err == nil {
+		t.Error("Expected an error for a map count above the data")
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("Allocated %v bytes for a truncated map", allocated)
+	}
+}
+
+func valuesEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !valuesEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case []Pair:
+		b, ok := b.([]Pair)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !valuesEqual(a[i].First, b[i].First) || !valuesEqual(a[i].Second, b[i].Second) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
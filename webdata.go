@@ -0,0 +1,159 @@
+package unity
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// WebGL data container (.data, .data.gz, .data.br)
+const SignatureWebData = "UnityWebData1.0"
+
+// Unity stores this as brotli metadata at the start of compressed WebGL files
+var brotliMarker = []byte("UnityWeb Compressed Content (brotli)")
+
+const brotliMarkerOffset = 0x20
+
+// Signatures a wrapped file can decompress to
+var bundleSignatures = []string{SignatureWebData, SignatureFS, SignatureWeb, SignatureRaw, SignatureArchive}
+
+// Reads the little endian file table of a WebGL data container. File
+// offsets are relative to the start of the container.
+func readWebData(bundle *Bundle, reader *Reader) (err error) {
+	reader.ChangeEndian(true)
+
+	headerSize, err := reader.Uint32()
+	if err != nil {
+		return formatError(StageHeader, reader.Tell(), err)
+	}
+	bundle.HeaderSize = headerSize
+
+	if int64(headerSize) > reader.Len() {
+		header, err := bundle.readAt(0, int64(headerSize))
+		if err != nil {
+			return formatError(StageHeader, 0, err)
+		}
+		offset := reader.Tell()
+		if reader, err = NewReader(header); err != nil {
+			return err
+		}
+		reader.ChangeEndian(true)
+		if _, err = reader.SeekStart(offset); err != nil {
+			return formatError(StageHeader, offset, err)
+		}
+	}
+
+	for reader.Tell() < int64(headerSize) {
+		offset, err := reader.Uint32()
+		if err != nil {
+			return formatError(StageDirectory, reader.Tell(), err)
+		}
+		size, err := reader.Uint32()
+		if err != nil {
+			return formatError(StageDirectory, reader.Tell(), err)
+		}
+		nameSize, err := reader.Uint32()
+		if err != nil {
+			return formatError(StageDirectory, reader.Tell(), err)
+		}
+		name, err := reader.Bytes(int64(nameSize))
+		if err != nil {
+			return formatError(StageDirectory, reader.Tell(), err)
+		}
+
+		bundle.Nodes = append(bundle.Nodes, ArchiveNode{
+			Offset: int64(offset),
+			Size:   int64(size),
+			Name:   string(name),
+		})
+	}
+
+	bundle.FileCount = uint32(len(bundle.Nodes))
+	bundle.storage = bundle.source
+
+	return bundle.addNodeAssets(bundle.size)
+}
+
+// Returns the decompressed contents of a gzip or brotli compressed file
+// starting with header, or nil if it isn't compressed. Only one level is
+// unwrapped: the contents must start with a bundle or WebData signature.
+func decompressWrapped(r io.ReaderAt, size int64, header []byte, limits Limits) (*Reader, error) {
+	var decompressed io.Reader
+	switch {
+	case len(header) >= 2 && header[0] == 0x1f && header[1] == 0x8b:
+		gz, err := gzip.NewReader(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		decompressed = gz
+	case isBrotli(header):
+		decompressed = brotli.NewReader(io.NewSectionReader(r, 0, size))
+	default:
+		return nil, nil
+	}
+
+	data, err := limits.readAll(decompressed)
+	if err != nil {
+		return nil, err
+	}
+	if !hasBundleSignature(data) {
+		return nil, fmt.Errorf("Decompressed data isn't a bundle or WebData container")
+	}
+	return NewReader(data)
+}
+
+func hasBundleSignature(data []byte) bool {
+	for _, sig := range bundleSignatures {
+		if bytes.HasPrefix(data, []byte(sig)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Brotli has no magic number, so besides Unity's marker a stream is
+// recognized by decompressing its start to a known signature.
+func isBrotli(header []byte) bool {
+	if len(header) >= brotliMarkerOffset+len(brotliMarker) &&
+		bytes.Equal(header[brotliMarkerOffset:brotliMarkerOffset+len(brotliMarker)], brotliMarker) {
+		return true
+	}
+
+	if hasBundleSignature(header) {
+		return false
+	}
+
+	start := make([]byte, len(SignatureWebData))
+	n, _ := io.ReadFull(brotli.NewReader(bytes.NewReader(header)), start)
+	for _, sig := range bundleSignatures {
+		if n >= len(sig) && bytes.HasPrefix(start, []byte(sig)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the node at index holds a serialized file or streamed
+// data, rather than e.g. a nested bundle or a script.
+func (bundle *Bundle) isAssetNode(index int) bool {
+	node := bundle.Nodes[index]
+	asset := Asset{Name: node.Name}
+	if asset.IsResource() {
+		return true
+	}
+
+	header := make([]byte, 48)
+	n, _ := bundle.storage.ReadAt(header[:min64(48, node.Size)], node.Offset)
+	return IsSerializedFile(header[:n], node.Size)
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
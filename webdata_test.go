@@ -0,0 +1,116 @@
+package unity
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func makeWebData(names []string, files [][]byte) []byte {
+	le := binary.LittleEndian
+	headerSize := len(SignatureWebData) + 1 + 4
+	for _, name := range names {
+		headerSize += 12 + len(name)
+	}
+
+	out := &bytes.Buffer{}
+	out.WriteString(SignatureWebData + "\x00")
+	binary.Write(out, le, uint32(headerSize))
+	offset := headerSize
+	for i, name := range names {
+		binary.Write(out, le, uint32(offset))
+		binary.Write(out, le, uint32(len(files[i])))
+		binary.Write(out, le, uint32(len(name)))
+		out.WriteString(name)
+		offset += len(files[i])
+	}
+	for _, file := range files {
+		out.Write(file)
+	}
+	return out.Bytes()
+}
+
+func TestWebData(t *testing.T) {
+	bundleData, err := ioutil.ReadFile("test/main_dxt1_bc1.unity3d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assetData := readTestSerializedFile(t, "test/20147_cs_h")
+
+	names := []string{"data.unity3d", "globalgamemanagers", "Il2CppData/Metadata/global-metadata.dat"}
+	plain := makeWebData(names, [][]byte{bundleData, assetData, []byte("metadata")})
+
+	gz := &bytes.Buffer{}
+	gw := gzip.NewWriter(gz)
+	gw.Write(plain)
+	gw.Close()
+
+	br := &bytes.Buffer{}
+	bw := brotli.NewWriter(br)
+	bw.Write(plain)
+	bw.Close()
+
+	for name, data := range map[string][]byte{"plain": plain, "gzip": gz.Bytes(), "brotli": br.Bytes()} {
+		bundle, err := OpenBundle(bytes.NewReader(data), int64(len(data)), nil)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if bundle.Signature != SignatureWebData || len(bundle.Nodes) != 3 {
+			t.Errorf("%s: Invalid signature or node count. Got: %v, %v", name, bundle.Signature, len(bundle.Nodes))
+			continue
+		}
+
+		if len(bundle.Assets) != 1 || bundle.Assets[0].Name != "globalgamemanagers" {
+			t.Errorf("%s: Expected only globalgamemanagers as asset. Got: %v", name, len(bundle.Assets))
+			continue
+		}
+
+		if err = bundle.ResolveAsset(0); err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if len(bundle.Assets[0].Objects) != 2 {
+			t.Errorf("%s: Invalid object count. Got: %v Expected: 2", name, len(bundle.Assets[0].Objects))
+		}
+
+		nested, err := bundle.OpenNestedBundle(bundle.FindNode("data.unity3d"), nil)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if err = nested.ResolveAsset(0); err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if len(nested.Assets[0].Objects) != 4 {
+			t.Errorf("%s: Invalid nested object count. Got: %v Expected: 4", name, len(nested.Assets[0].Objects))
+		}
+	}
+}
+
+func TestNestedWrappers(t *testing.T) {
+	gzipData := func(data []byte) []byte {
+		out := &bytes.Buffer{}
+		w := gzip.NewWriter(out)
+		w.Write(data)
+		w.Close()
+		return out.Bytes()
+	}
+
+	// Only one level is unwrapped, so nested wrappers and other data fail
+	plain := makeWebData([]string{"a"}, [][]byte{[]byte("a")})
+	for name, data := range map[string][]byte{
+		"gzip in gzip": gzipData(gzipData(plain)),
+		"not a bundle": gzipData([]byte("UnityUnknown")),
+	} {
+		if _, err := OpenBundle(bytes.NewReader(data), int64(len(data)), nil); err == nil {
+			t.Errorf("%v: Expected an error", name)
+		}
+	}
+	data := gzipData(plain)
+	if _, err := OpenBundle(bytes.NewReader(data), int64(len(data)), nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,97 @@
+package unity
+
+import (
+	"encoding/binary"
+)
+
+// Serializes values in a configurable byte order, mirroring Reader
+type Writer struct {
+	buf    []byte
+	endian binary.ByteOrder
+}
+
+func NewWriter() *Writer {
+	return &Writer{nil, binary.BigEndian}
+}
+
+func (w *Writer) ChangeEndian(isLittleEndian bool) {
+	if isLittleEndian {
+		w.endian = binary.LittleEndian
+	} else {
+		w.endian = binary.BigEndian
+	}
+}
+
+func (w *Writer) Endian() binary.ByteOrder {
+	return w.endian
+}
+
+func (w *Writer) Len() int64 {
+	return int64(len(w.buf))
+}
+
+// Returns the written data
+func (w *Writer) Data() []byte {
+	return w.buf
+}
+
+// Implements io.Writer by appending p
+func (w *Writer) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func (w *Writer) Align() {
+	w.AlignTo(4)
+}
+
+// Pads the data with zeros to a multiple of n, which must be a power of two
+func (w *Writer) AlignTo(n int64) {
+	for w.Len()&(n-1) != 0 {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *Writer) Uint8(x uint8) {
+	w.buf = append(w.buf, x)
+}
+
+func (w *Writer) Int8(x int8) {
+	w.buf = append(w.buf, byte(x))
+}
+
+func (w *Writer) Uint16(x uint16) {
+	var b [2]byte
+	w.endian.PutUint16(b[:], x)
+	w.buf = append(w.buf, b[:]...)
+}
+
+func (w *Writer) Int16(x int16) {
+	w.Uint16(uint16(x))
+}
+
+func (w *Writer) Uint32(x uint32) {
+	var b [4]byte
+	w.endian.PutUint32(b[:], x)
+	w.buf = append(w.buf, b[:]...)
+}
+
+func (w *Writer) Int32(x int32) {
+	w.Uint32(uint32(x))
+}
+
+func (w *Writer) Uint64(x uint64) {
+	var b [8]byte
+	w.endian.PutUint64(b[:], x)
+	w.buf = append(w.buf, b[:]...)
+}
+
+func (w *Writer) Int64(x int64) {
+	w.Uint64(uint64(x))
+}
+
+// Writes the string followed by a null byte
+func (w *Writer) StringNull(s string) {
+	w.buf = append(w.buf, s...)
+	w.buf = append(w.buf, 0)
+}